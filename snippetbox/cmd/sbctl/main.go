@@ -0,0 +1,14 @@
+// The sbctl command is a command-line client for Snippetbox. It talks to the
+// JSON API of the server over HTTPS, authenticated with a personal access
+// token. Run it without arguments for the list of commands
+package main
+
+import (
+	"os"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/sbclient"
+)
+
+func main() {
+	os.Exit(sbclient.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/validator"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/ui"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The JSON API lives under /api/v1. Its handlers use the same models, forms
+// and validation as the HTML handlers, but read and write JSON. Instead of
+// session cookies, API clients authenticate every request (see
+// apiAuthenticate), so the API needs no CSRF protection either
+
+// Define an envelope type for the JSON response bodies. Every response is a
+// JSON object, with the data under a descriptive key
+type envelope map[string]any
+
+// The maximum size of a JSON request body
+const maxJSONBytes = 1 << 20
+
+// Define an apiFile type to hold a file of a snippet in the JSON API
+type apiFile struct {
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	Language string `json:"language,omitempty"`
+}
+
+// Define an apiSnippet type to hold a snippet in the JSON API responses. The
+// expiry time is null for snippets which never expire
+type apiSnippet struct {
+	ID               string     `json:"id"`
+	Title            string     `json:"title"`
+	Content          string     `json:"content,omitempty"`
+	Language         string     `json:"language"`
+	Filename         string     `json:"filename,omitempty"`
+	Files            []apiFile  `json:"files,omitempty"`
+	Tags             []string   `json:"tags,omitempty"`
+	Visibility       string     `json:"visibility"`
+	Protected        bool       `json:"protected"`
+	BurnAfterReading bool       `json:"burn_after_reading"`
+	UserID           string     `json:"user_id"`
+	Author           string     `json:"author,omitempty"`
+	ForkedFrom       string     `json:"forked_from,omitempty"`
+	Forks            int        `json:"forks"`
+	Stars            int        `json:"stars"`
+	Created          time.Time  `json:"created"`
+	Expires          *time.Time `json:"expires"`
+}
+
+// Create an apiSnippet from a snippet. Lists of snippets leave out the
+// content and the files, which are only sent (withContent) for a single
+// snippet
+func newAPISnippet(snippet models.Snippet, withContent bool) apiSnippet {
+	s := apiSnippet{
+		ID:               snippet.ID,
+		Title:            snippet.Title,
+		Language:         snippet.Language,
+		Filename:         snippet.Filename,
+		Tags:             snippet.Tags,
+		Visibility:       snippet.Visibility,
+		Protected:        snippet.IsProtected(),
+		BurnAfterReading: snippet.BurnAfterReading,
+		UserID:           snippet.UserID,
+		Author:           snippet.Author,
+		ForkedFrom:       snippet.ForkedFrom,
+		Forks:            snippet.Forks,
+		Stars:            snippet.Stars,
+		Created:          snippet.Created,
+	}
+
+	// Snippets created before visibility levels were added are public
+	if s.Visibility == "" {
+		s.Visibility = models.VisibilityPublic
+	}
+
+	if !snippet.Expires.IsZero() {
+		expires := snippet.Expires
+		s.Expires = &expires
+	}
+
+	if withContent {
+		s.Content = snippet.Content
+		for _, file := range snippet.Files {
+			s.Files = append(s.Files, apiFile(file))
+		}
+	}
+
+	return s
+}
+
+// Define an apiSnippetInput type to hold a snippet sent to the JSON API. The
+// fields mean the same as the fields of the snippet form, except ExpiresAt,
+// which is in the RFC 3339 format
+type apiSnippetInput struct {
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Language   string    `json:"language"`
+	Visibility string    `json:"visibility"`
+	Passphrase string    `json:"passphrase"`
+	Expires    string    `json:"expires"`
+	ExpiresAt  string    `json:"expires_at"`
+	Filename   string    `json:"filename"`
+	Files      []apiFile `json:"files"`
+	Tags       []string  `json:"tags"`
+}
+
+// Convert the input to the snippet form, so that it is validated and turned
+// into a snippet in the same way
+func (input apiSnippetInput) form() snippetCreateForm {
+	form := snippetCreateForm{
+		Title:      input.Title,
+		Content:    input.Content,
+		Language:   input.Language,
+		Visibility: input.Visibility,
+		Passphrase: input.Passphrase,
+		Expires:    input.Expires,
+		ExpiresAt:  input.ExpiresAt,
+		Filename:   input.Filename,
+		Tags:       strings.Join(input.Tags, ","),
+	}
+
+	for _, file := range input.Files {
+		form.Files = append(form.Files, snippetFileForm(file))
+	}
+
+	// A time which can't be parsed is passed on as it is, and fails the
+	// validation of the form
+	if expiresAt, err := time.Parse(time.RFC3339, input.ExpiresAt); err == nil {
+		form.ExpiresAt = expiresAt.UTC().Format(expiresAtLayout)
+	}
+
+	return form
+}
+
+// The writeJSON() helper sends the data as a JSON response with the status
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		// Only values which can't be encoded (like channels) fail, which
+		// is a bug
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// The readJSON() helper decodes the JSON request body into dst. The body
+// must hold a single JSON value, without fields dst doesn't have
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return fmt.Errorf("body contains invalid JSON: %w", err)
+		}
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// The apiError() helper sends a JSON error response with the status and a
+// message for the client
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": message})
+}
+
+// The apiServerError() helper logs the error like serverError() does, and
+// sends a generic JSON error response
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		method = r.Method
+		uri    = r.URL.RequestURI()
+		trace  = string(debug.Stack())
+	)
+	app.logger.Error(err.Error(), "method", method, "uri", uri, "trace", trace)
+	app.apiError(w, http.StatusInternalServerError, "the server encountered a problem and could not process the request")
+}
+
+// The apiValidationError() helper sends the field errors of a form, keyed
+// by the names of the fields
+func (app *application) apiValidationError(w http.ResponseWriter, v validator.Validator) {
+	body := envelope{"error": "validation failed", "fields": v.FieldErrors}
+	if len(v.NonFieldErrors) > 0 {
+		body["errors"] = v.NonFieldErrors
+	}
+	app.writeJSON(w, http.StatusUnprocessableEntity, body)
+}
+
+// The apiSnippetError() helper sends the response for an error returned by
+// the snippet models
+func (app *application) apiSnippetError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrBurned):
+		app.apiError(w, http.StatusGone, "the snippet has been burned after reading")
+	case errors.Is(err, models.ErrNoRecord):
+		app.apiError(w, http.StatusNotFound, "the snippet could not be found")
+	case errors.Is(err, models.ErrNotOwner):
+		app.apiError(w, http.StatusForbidden, "the snippet belongs to another user")
+	default:
+		app.apiServerError(w, r, err)
+	}
+}
+
+// The apiSpec() handler serves the OpenAPI document of the JSON API, which
+// is embedded with the other UI files
+func (app *application) apiSpec(w http.ResponseWriter, r *http.Request) {
+	http.ServeFileFS(w, r, ui.Files, "openapi.json")
+}
+
+func (app *application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+}
+
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	var form snippetBrowseForm
+
+	err := app.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, "invalid query string")
+		return
+	}
+
+	filter := form.filter()
+
+	if !form.Valid() {
+		app.apiValidationError(w, form.Validator)
+		return
+	}
+
+	snippets, cursor, err := app.snippets.Browse(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.apiError(w, http.StatusBadRequest, "invalid cursor")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	list := make([]apiSnippet, len(snippets))
+	for i, snippet := range snippets {
+		list[i] = newAPISnippet(snippet, false)
+	}
+
+	// The next page is requested with the cursor of this one
+	body := envelope{"snippets": list}
+	if cursor != "" {
+		body["next_cursor"] = cursor
+	}
+
+	app.writeJSON(w, http.StatusOK, body)
+}
+
+func (app *application) apiAccountSnippets(w http.ResponseWriter, r *http.Request) {
+	var query accountSnippetsQuery
+
+	// Out of range values fall back to the defaults, like on the "My
+	// snippets" page
+	err := app.formDecoder.Decode(&query, r.URL.Query())
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, "invalid query string")
+		return
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	if !validator.PermittedValue(query.Sort, models.SnippetSortFields...) {
+		query.Sort = "created"
+	}
+
+	snippets, total, err := app.snippets.ByOwner(app.authenticatedUserID(r), query.Page, accountSnippetsPageSize, query.Sort, query.Expired)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	list := make([]apiSnippet, len(snippets))
+	for i, snippet := range snippets {
+		list[i] = newAPISnippet(snippet, false)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"snippets":  list,
+		"page":      query.Page,
+		"page_size": accountSnippetsPageSize,
+		"total":     total,
+	})
+}
+
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if !primitive.IsValidObjectID(id) {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		app.apiSnippetError(w, r, err)
+		return
+	}
+
+	// Without sessions, a protected snippet of another user is unlocked with
+	// its passphrase in a header of every request
+	if snippet.IsProtected() && snippet.UserID != app.authenticatedUserID(r) {
+		passphrase := r.Header.Get("X-Snippet-Passphrase")
+		if passphrase == "" {
+			app.apiError(w, http.StatusForbidden, "the snippet is protected, send its passphrase in the X-Snippet-Passphrase header")
+			return
+		}
+
+		err = app.snippets.Unlock(id, app.authenticatedUserID(r), passphrase)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.apiError(w, http.StatusForbidden, "the passphrase is incorrect")
+			} else {
+				app.apiSnippetError(w, r, err)
+			}
+			return
+		}
+	}
+
+	// Reading a burn after reading snippet deletes it, like viewing it does.
+	// HEAD requests don't read it, so they don't burn it
+	if snippet.BurnAfterReading {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		snippet, err = app.snippets.Burn(id, app.authenticatedUserID(r))
+		if err != nil {
+			app.apiSnippetError(w, r, err)
+			return
+		}
+
+		app.notifySnippet(r, models.EventSnippetExpired, snippet)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newAPISnippet(snippet, true)})
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var input apiSnippetInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Unlike in the form, the visibility and the expiry can be left out
+	if input.Visibility == "" {
+		input.Visibility = models.VisibilityPublic
+	}
+	if input.Expires == "" {
+		input.Expires = defaultExpiry
+	}
+
+	form := input.form()
+	form.validate()
+	form.CheckField(form.Expires != expiresKeep, "expires", "Only edited snippets can keep their expiry time")
+
+	if !form.Valid() {
+		app.apiValidationError(w, form.Validator)
+		return
+	}
+
+	snippet := form.snippet("", app.authenticatedUserID(r))
+	snippet.ID, err = app.createSnippet(r, snippet, form.Passphrase)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	// The stored snippet has these values too, without reading it back
+	snippet.Created = time.Now()
+	response := newAPISnippet(snippet, true)
+	response.Protected = form.Passphrase != ""
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%s", snippet.ID))
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": response})
+}
+
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if !primitive.IsValidObjectID(id) {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	var input apiSnippetInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	current, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		app.apiSnippetError(w, r, err)
+		return
+	}
+
+	if current.UserID != app.authenticatedUserID(r) {
+		app.apiSnippetError(w, r, models.ErrNotOwner)
+		return
+	}
+
+	// The current visibility and expiry time are kept unless others are sent
+	if input.Visibility == "" {
+		input.Visibility = current.Visibility
+		if input.Visibility == "" {
+			input.Visibility = models.VisibilityPublic
+		}
+	}
+	if input.Expires == "" {
+		input.Expires = expiresKeep
+	}
+
+	form := input.form()
+	form.validate()
+	form.CheckField(form.Expires != burnAfterReading, "expires", "Only new snippets can be burned after reading")
+	form.CheckField(form.Passphrase == "", "passphrase", "A passphrase can only be set when a snippet is created")
+
+	if !form.Valid() {
+		app.apiValidationError(w, form.Validator)
+		return
+	}
+
+	snippet := form.snippet(id, app.authenticatedUserID(r))
+	err = app.updateSnippet(r, snippet, form.Expires == expiresKeep)
+	if err != nil {
+		app.apiSnippetError(w, r, err)
+		return
+	}
+
+	// Keep the values which the update doesn't change
+	snippet.Created = current.Created
+	snippet.Author = current.Author
+	snippet.HashedPassphrase = current.HashedPassphrase
+	snippet.BurnAfterReading = current.BurnAfterReading
+	snippet.ForkedFrom = current.ForkedFrom
+	snippet.Forks = current.Forks
+	snippet.Stars = current.Stars
+	if form.Expires == expiresKeep {
+		snippet.Expires = current.Expires
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newAPISnippet(snippet, true)})
+}
+
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if !primitive.IsValidObjectID(id) {
+		app.apiNotFound(w, r)
+		return
+	}
+
+	err := app.deleteSnippet(r, id, app.authenticatedUserID(r))
+	if err != nil {
+		app.apiSnippetError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+)
+
+// Return the headers of a JSON API request made by the user with the email
+// and password
+func apiHeader(email string, password string) http.Header {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(email, password)
+	req.Header.Set("Content-Type", "application/json")
+	return req.Header
+}
+
+// The headers of a JSON API request made by the mocked user with ID
+// 111111111111111111111111
+var aliceHeader = apiHeader("alice@example.com", "pa$$word")
+
+func TestAPISnippetList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Public snippets",
+			urlPath:  "/api/v1/snippets",
+			wantCode: http.StatusOK,
+			wantBody: `"title": "An old silent pond"`,
+		},
+		{
+			name:     "Snippets of an author",
+			urlPath:  "/api/v1/snippets?author=111111111111111111111111",
+			wantCode: http.StatusOK,
+			wantBody: `"author": "Alice Jones"`,
+		},
+		{
+			name:     "Invalid date",
+			urlPath:  "/api/v1/snippets?from=yesterday",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"from": "This field must be a valid date"`,
+		},
+		{
+			name:     "Unknown resource",
+			urlPath:  "/api/v1/nothing",
+			wantCode: http.StatusNotFound,
+			wantBody: `"error": "the requested resource could not be found"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Content-Type"), "application/json")
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+
+	// Lists leave out the content of the snippets
+	_, _, body := ts.get(t, "/api/v1/snippets")
+
+	var response struct {
+		Snippets []apiSnippet `json:"snippets"`
+	}
+
+	err := json.Unmarshal([]byte(body), &response)
+	assert.NilError(t, err)
+	assert.Equal(t, len(response.Snippets), 1)
+	assert.Equal(t, response.Snippets[0].ID, "111111111111111111111111")
+	assert.Equal(t, response.Snippets[0].Content, "")
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid credentials",
+			header:   aliceHeader,
+			wantCode: http.StatusOK,
+			wantBody: `"total": 1`,
+		},
+		{
+			name:     "Wrong password",
+			header:   apiHeader("alice@example.com", "wrong"),
+			wantCode: http.StatusUnauthorized,
+			wantBody: `"error": "invalid authentication credentials"`,
+		},
+		{
+			name:     "No credentials",
+			wantCode: http.StatusUnauthorized,
+			wantBody: `"error": "you must be authenticated to access this resource"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.request(t, http.MethodGet, "/api/v1/account/snippets", "", tt.header)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+
+			if code == http.StatusUnauthorized {
+				assert.StringContains(t, strings.Join(headers.Values("WWW-Authenticate"), ", "), `Basic realm="snippetbox"`)
+			}
+		})
+	}
+}
+
+func TestAPISnippetGet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		header   http.Header
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  "/api/v1/snippets/111111111111111111111111",
+			wantCode: http.StatusOK,
+			wantBody: `"content": "An old silent pond..."`,
+		},
+		{
+			name:     "Files",
+			urlPath:  "/api/v1/snippets/aaaaaaaaaaaaaaaaaaaaaaaa",
+			wantCode: http.StatusOK,
+			wantBody: `"name": "go.mod"`,
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/api/v1/snippets/222222222222222222222222",
+			wantCode: http.StatusNotFound,
+			wantBody: `"error": "the snippet could not be found"`,
+		},
+		{
+			name:     "Invalid ID",
+			urlPath:  "/api/v1/snippets/foo",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private snippet of another user",
+			urlPath:  "/api/v1/snippets/444444444444444444444444",
+			header:   aliceHeader,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Protected snippet without passphrase",
+			urlPath:  "/api/v1/snippets/555555555555555555555555",
+			wantCode: http.StatusForbidden,
+			wantBody: "X-Snippet-Passphrase",
+		},
+		{
+			name:     "Protected snippet with wrong passphrase",
+			urlPath:  "/api/v1/snippets/555555555555555555555555",
+			header:   http.Header{"X-Snippet-Passphrase": {"wrong"}},
+			wantCode: http.StatusForbidden,
+			wantBody: `"error": "the passphrase is incorrect"`,
+		},
+		{
+			name:     "Protected snippet with passphrase",
+			urlPath:  "/api/v1/snippets/555555555555555555555555",
+			header:   http.Header{"X-Snippet-Passphrase": {"open sesame"}},
+			wantCode: http.StatusOK,
+			wantBody: `"content": "Lightning flash..."`,
+		},
+		{
+			name:     "Burn after reading snippet",
+			urlPath:  "/api/v1/snippets/666666666666666666666666",
+			wantCode: http.StatusOK,
+			wantBody: `"burn_after_reading": true`,
+		},
+		{
+			name:     "Burned snippet",
+			urlPath:  "/api/v1/snippets/777777777777777777777777",
+			wantCode: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.request(t, http.MethodGet, tt.urlPath, "", tt.header)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAPISnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		body         string
+		header       http.Header
+		wantCode     int
+		wantBody     string
+		wantLocation string
+	}{
+		{
+			name:         "Valid snippet",
+			body:         `{"title": "O snail", "content": "Climb Mount Fuji", "tags": ["haiku"]}`,
+			header:       aliceHeader,
+			wantCode:     http.StatusCreated,
+			wantBody:     `"id": "222222222222222222222222"`,
+			wantLocation: "/api/v1/snippets/222222222222222222222222",
+		},
+		{
+			name:         "Expiry time",
+			body:         `{"title": "O snail", "content": "Climb Mount Fuji", "expires": "custom", "expires_at": "2999-01-01T00:00:00Z"}`,
+			header:       aliceHeader,
+			wantCode:     http.StatusCreated,
+			wantBody:     `"expires": "2999-01-01T00:00:00Z"`,
+			wantLocation: "/api/v1/snippets/222222222222222222222222",
+		},
+		{
+			name:     "Missing fields",
+			body:     `{"title": ""}`,
+			header:   aliceHeader,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"title": "This field cannot be blank"`,
+		},
+		{
+			name:     "Unknown field",
+			body:     `{"title": "O snail", "author": "Issa"}`,
+			header:   aliceHeader,
+			wantCode: http.StatusBadRequest,
+			wantBody: `unknown field`,
+		},
+		{
+			name:     "Invalid JSON",
+			body:     `{"title": `,
+			header:   aliceHeader,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Anonymous",
+			body:     `{"title": "O snail", "content": "Climb Mount Fuji"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.request(t, http.MethodPost, "/api/v1/snippets", tt.body, tt.header)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestAPISnippetUpdate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	snippet, err := app.snippets.Get("111111111111111111111111", "111111111111111111111111")
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Own snippet",
+			urlPath:  "/api/v1/snippets/111111111111111111111111",
+			body:     `{"title": "A new silent pond", "content": "An old silent pond..."}`,
+			wantCode: http.StatusOK,
+			wantBody: `"title": "A new silent pond"`,
+		},
+		{
+			// The expiry time which is left out is kept exactly
+			name:     "Unchanged expiry",
+			urlPath:  "/api/v1/snippets/111111111111111111111111",
+			body:     `{"title": "A new silent pond", "content": "An old silent pond..."}`,
+			wantCode: http.StatusOK,
+			wantBody: `"expires": "` + snippet.Expires.Format(time.RFC3339Nano) + `"`,
+		},
+		{
+			name:     "Foreign snippet",
+			urlPath:  "/api/v1/snippets/333333333333333333333333",
+			body:     `{"title": "A toad", "content": "A toad jumps into the pond..."}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/api/v1/snippets/222222222222222222222222",
+			body:     `{"title": "A toad", "content": "A toad jumps into the pond..."}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Passphrase",
+			urlPath:  "/api/v1/snippets/111111111111111111111111",
+			body:     `{"title": "A new silent pond", "content": "An old silent pond...", "passphrase": "open sesame"}`,
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: `"passphrase": "A passphrase can only be set when a snippet is created"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.request(t, http.MethodPut, tt.urlPath, tt.body, aliceHeader)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestAPISnippetDelete(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		header   http.Header
+		wantCode int
+	}{
+		{
+			name:     "Own snippet",
+			urlPath:  "/api/v1/snippets/111111111111111111111111",
+			header:   aliceHeader,
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Foreign snippet",
+			urlPath:  "/api/v1/snippets/333333333333333333333333",
+			header:   aliceHeader,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/api/v1/snippets/222222222222222222222222",
+			header:   aliceHeader,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Anonymous",
+			urlPath:  "/api/v1/snippets/111111111111111111111111",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.request(t, http.MethodDelete, tt.urlPath, "", tt.header)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, headers, body := ts.get(t, "/api/openapi.json")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "application/json")
+
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+
+	err := json.Unmarshal([]byte(body), &spec)
+	assert.NilError(t, err)
+	assert.StringContains(t, spec.OpenAPI, "3.")
+	assert.Equal(t, len(spec.Servers), 1)
+
+	// Collect the operations of the document as "METHOD /path", like the
+	// patterns of the routes. The other keys of a path item (like
+	// "parameters") aren't operations
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for key := range item {
+			method := strings.ToUpper(key)
+			switch method {
+			case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				documented[method+" "+spec.Servers[0].URL+path] = true
+			}
+		}
+	}
+
+	routes := make(map[string]bool)
+	for _, route := range app.apiRoutes() {
+		pattern := route.method + " " + route.path
+		routes[pattern] = true
+
+		if !documented[pattern] {
+			t.Errorf("route %q is missing from the OpenAPI document", pattern)
+		}
+
+		// Make sure the route is registered in app.routes(), and doesn't
+		// fall through to the catch-all of the API
+		t.Run(pattern, func(t *testing.T) {
+			urlPath := strings.ReplaceAll(route.path, "{id}", "111111111111111111111111")
+
+			code, _, body := ts.request(t, route.method, urlPath, "", aliceHeader)
+			if code == http.StatusMethodNotAllowed || strings.Contains(body, "the requested resource could not be found") {
+				t.Errorf("route %q is not registered", pattern)
+			}
+		})
+	}
+
+	for pattern := range documented {
+		if !routes[pattern] {
+			t.Errorf("the OpenAPI document lists %q, which is not a route", pattern)
+		}
+	}
+}
+
+func TestAPIDocs(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The docs page is a static file, which only loads scripts from the
+	// application itself
+	code, headers, body := ts.get(t, "/static/api/")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, headers.Get("Content-Security-Policy"), "default-src 'self'")
+	assert.StringContains(t, body, "<script src='/static/js/apidocs.js'")
+}
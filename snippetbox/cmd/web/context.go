@@ -3,3 +3,10 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+
+// Holds the ID of the authenticated user making the request
+const authenticatedUserIDContextKey = contextKey("authenticatedUserID")
+
+// Set when the request is authenticated with a personal access token instead
+// of the session
+const tokenAuthenticatedContextKey = contextKey("tokenAuthenticated")
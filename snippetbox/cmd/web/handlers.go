@@ -1,10 +1,17 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	syntax "github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/highlight"
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/validator"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,9 +23,265 @@ import (
 // must be exported in order to be read by the html/template package when
 // rendering the template
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Language            string            `form:"language"`
+	Visibility          string            `form:"visibility"`
+	Passphrase          string            `form:"passphrase"`
+	Expires             string            `form:"expires"`
+	ExpiresAt           string            `form:"expires_at"`
+	Filename            string            `form:"filename"`
+	Files               []snippetFileForm `form:"files"`
+	Tags                string            `form:"tags"`
+	AddFile             bool              `form:"add_file"`
+	RemoveFile          int               `form:"remove_file"`
+	validator.Validator `form:"-"`
+}
+
+// Define a snippetFileForm struct to hold one of the additional files of the
+// snippet form. They are sent as files[0].name, files[0].content and so on
+type snippetFileForm struct {
+	Name     string `form:"name"`
+	Content  string `form:"content"`
+	Language string `form:"language"`
+}
+
+// The maximum number of files of a snippet, including the main one
+const maxSnippetFiles = 10
+
+// The maximum number of tags of a snippet, and of characters of a tag
+const (
+	maxSnippetTags   = 5
+	maxSnippetTagLen = 30
+)
+
+// The expires values of the form which keep the snippet for a fixed time
+var expiryDurations = map[string]time.Duration{
+	"10m":  10 * time.Minute,
+	"1h":   time.Hour,
+	"1d":   24 * time.Hour,
+	"7d":   7 * 24 * time.Hour,
+	"365d": 365 * 24 * time.Hour,
+}
+
+// The expires value preselected for new snippets
+const defaultExpiry = "365d"
+
+// The other expires values of the form. A custom expiry time is taken from
+// the ExpiresAt field, and a burn after reading snippet is deleted by its first
+// viewer, or after burnAfterReadingLifetime if nobody reads it. An edited
+// snippet can keep its current expiry time
+const (
+	expiresNever     = "never"
+	expiresCustom    = "custom"
+	expiresKeep      = "keep"
+	burnAfterReading = "burn"
+)
+
+const burnAfterReadingLifetime = 7 * 24 * time.Hour
+
+// The format of the HTML datetime-local input. The time is in UTC, like all
+// the times shown by the application
+const expiresAtLayout = "2006-01-02T15:04"
+
+// Validate the snippet form data. The same checks are used when a snippet
+// is created and when it is edited
+func (form *snippetCreateForm) validate() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.CheckField(form.Language == "" || validator.PermittedValue(form.Language, syntax.Names()...), "language", "This field must be one of the supported languages")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.Visibilities...), "visibility", "This field must equal public, unlisted or private")
+	form.CheckField(form.Passphrase == "" || validator.MinChars(form.Passphrase, 8), "passphrase", "This field must be at least 8 characters long")
+
+	_, fixed := expiryDurations[form.Expires]
+	form.CheckField(fixed || validator.PermittedValue(form.Expires, expiresNever, expiresCustom, expiresKeep, burnAfterReading), "expires", "This field must be one of the listed expiry options")
+
+	// A custom expiry time must be in the future
+	if form.Expires == expiresCustom {
+		expiresAt, err := time.Parse(expiresAtLayout, form.ExpiresAt)
+		form.CheckField(err == nil && expiresAt.After(time.Now()), "expires_at", "This field must be a date and time in the future")
+	}
+
+	// The main file needs a name once there are other files, so that all the
+	// files can be told apart
+	form.CheckField(form.Filename != "" || len(form.Files) == 0, "filename", "This field cannot be blank when the snippet has more files")
+	form.CheckField(form.Filename == "" || validator.Matches(form.Filename, validator.FilenameRX), "filename", "This field must be a file name without spaces or slashes")
+	form.CheckField(validator.MaxChars(form.Filename, 100), "filename", "This field cannot be more than 100 characters long")
+	form.CheckField(len(form.Files) < maxSnippetFiles, "files", fmt.Sprintf("A snippet can't have more than %d files", maxSnippetFiles))
+
+	names := []string{form.Filename}
+	for i := range form.Files {
+		file := &form.Files[i]
+		key := fmt.Sprintf("files.%d.", i)
+
+		form.CheckField(validator.NotBlank(file.Name), key+"name", "This field cannot be blank")
+		form.CheckField(validator.Matches(file.Name, validator.FilenameRX), key+"name", "This field must be a file name without spaces or slashes")
+		form.CheckField(validator.MaxChars(file.Name, 100), key+"name", "This field cannot be more than 100 characters long")
+		form.CheckField(!validator.PermittedValue(file.Name, names...), key+"name", "This file name is already used")
+		form.CheckField(validator.NotBlank(file.Content), key+"content", "This field cannot be blank")
+		form.CheckField(file.Language == "" || validator.PermittedValue(file.Language, syntax.Names()...), key+"language", "This field must be one of the supported languages")
+		names = append(names, file.Name)
+
+		if file.Language == "" {
+			file.Language = syntax.DetectFile(file.Name, file.Content)
+		}
+	}
+
+	// Tags are entered as a comma separated list
+	tags := form.tags()
+	form.CheckField(validator.MaxItems(tags, maxSnippetTags), "tags", fmt.Sprintf("A snippet can't have more than %d tags", maxSnippetTags))
+	form.CheckField(validator.Unique(tags), "tags", "Every tag must be used once")
+	for _, tag := range tags {
+		form.CheckField(validator.Matches(tag, validator.SlugRX), "tags", "Tags must be lowercase letters and digits, which may be joined with dashes")
+		form.CheckField(validator.MaxChars(tag, maxSnippetTagLen), "tags", fmt.Sprintf("Tags cannot be more than %d characters long", maxSnippetTagLen))
+	}
+
+	// Guess the language if the author didn't choose one
+	if form.Language == "" {
+		form.Language = syntax.DetectFile(form.Filename, form.Content)
+	}
+}
+
+// Split the comma separated tags of the form. Tags are trimmed and lowercased,
+// and empty items (like the one after a trailing comma) are skipped
+func (form *snippetCreateForm) tags() []string {
+	var tags []string
+	for _, tag := range strings.Split(form.Tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Handle the "Add file" and "Remove" buttons of the form. They submit the
+// whole form, so that file rows can be added and removed on the server,
+// without scripts. Returns true if one of them was pressed
+func (form *snippetCreateForm) editFiles() bool {
+	switch {
+	case form.AddFile:
+		form.CheckField(len(form.Files)+1 < maxSnippetFiles, "files", fmt.Sprintf("A snippet can't have more than %d files", maxSnippetFiles))
+		if form.Valid() {
+			form.Files = append(form.Files, snippetFileForm{})
+		}
+		return true
+	case form.RemoveFile > 0 && form.RemoveFile <= len(form.Files):
+		form.Files = slices.Delete(form.Files, form.RemoveFile-1, form.RemoveFile)
+		return true
+	default:
+		return false
+	}
+}
+
+// Create a snippet from the validated form data, owned by the given user
+func (form *snippetCreateForm) snippet(id string, userID string) models.Snippet {
+	snippet := models.Snippet{
+		ID:         id,
+		Title:      form.Title,
+		Content:    form.Content,
+		Language:   form.Language,
+		Visibility: form.Visibility,
+		UserID:     userID,
+		Filename:   form.Filename,
+		Tags:       form.tags(),
+	}
+
+	for _, file := range form.Files {
+		snippet.Files = append(snippet.Files, models.File{
+			Name:     file.Name,
+			Content:  file.Content,
+			Language: file.Language,
+		})
+	}
+
+	// A snippet which never expires keeps the zero expiry time. The current
+	// expiry time which is kept is set by updateSnippet()
+	switch form.Expires {
+	case expiresNever, expiresKeep:
+	case expiresCustom:
+		snippet.Expires, _ = time.Parse(expiresAtLayout, form.ExpiresAt)
+	case burnAfterReading:
+		snippet.Expires = time.Now().Add(burnAfterReadingLifetime)
+		snippet.BurnAfterReading = true
+	default:
+		snippet.Expires = time.Now().Add(expiryDurations[form.Expires])
+	}
+
+	return snippet
+}
+
+// Define a commentForm struct to hold a new comment on a snippet. Parent is
+// the id of the comment it replies to, if any, and Line the line of the
+// snippet content it is about, if any
+type commentForm struct {
+	Body                string `form:"body"`
+	Line                int    `form:"line"`
+	Parent              string `form:"parent"`
+	validator.Validator `form:"-"`
+}
+
+// The maximum number of characters of a comment
+const maxCommentChars = 2000
+
+// Define a collectionForm struct to hold the form data of a collection. The
+// same form is used when a collection is created and when it is edited
+type collectionForm struct {
+	Name                string `form:"name"`
+	Description         string `form:"description"`
+	Visibility          string `form:"visibility"`
+	validator.Validator `form:"-"`
+}
+
+// Validate the collection form data
+func (form *collectionForm) validate() {
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.MaxChars(form.Description, 1000), "description", "This field cannot be more than 1000 characters long")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.Visibilities...), "visibility", "This field must equal public, unlisted or private")
+}
+
+// Define a collectionSnippetForm struct to hold the snippet which is added
+// to, removed from or moved in a collection. Offset is the number of places
+// a snippet is moved by: -1 moves it up and 1 down
+type collectionSnippetForm struct {
+	SnippetID string `form:"snippet_id"`
+	Offset    int    `form:"offset"`
+}
+
+// Define a tokenForm struct to hold the form data of a new personal access
+// token
+type tokenForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"`
+	validator.Validator `form:"-"`
+}
+
+// Validate the token form data
+func (form *tokenForm) validate() {
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedValue(form.Scope, models.TokenScopes...), "scope", "This field must equal read or read-write")
+}
+
+// Define a webhookForm struct to hold the form data of a new webhook
+type webhookForm struct {
+	URL                 string `form:"url"`
+	validator.Validator `form:"-"`
+}
+
+// Validate the webhook form data
+func (form *webhookForm) validate() {
+	form.CheckField(validator.NotBlank(form.URL), "url", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.URL, 500), "url", "This field cannot be more than 500 characters long")
+	form.CheckField(validator.WebURL(form.URL), "url", "This field must be an http or https URL")
+	form.CheckField(validator.PublicHost(form.URL), "url", "This field must be a URL on the public internet")
+}
+
+// Define a snippetUnlockForm struct to hold the passphrase of a protected snippet
+type snippetUnlockForm struct {
+	Passphrase          string `form:"passphrase"`
 	validator.Validator `form:"-"`
 }
 
@@ -37,6 +300,119 @@ type userLoginForm struct {
 	validator.Validator `form:"-"`
 }
 
+// Define an accountSnippetsQuery struct to hold the query string parameters
+// of the "My snippets" page
+type accountSnippetsQuery struct {
+	Page    int    `form:"page"`
+	Sort    string `form:"sort"`
+	Expired bool   `form:"expired"`
+}
+
+// The number of snippets shown on one page of the "My snippets" page
+const accountSnippetsPageSize = 20
+
+// Define a snippetBrowseForm struct to hold the filters of the snippet browse
+// page. They are sent in the query string, with the dates in the format of
+// the HTML date input
+type snippetBrowseForm struct {
+	Author              string `form:"author"`
+	From                string `form:"from"`
+	To                  string `form:"to"`
+	Cursor              string `form:"cursor"`
+	validator.Validator `form:"-"`
+}
+
+// The number of snippets shown on one page of the browse page
+const browseSnippetsPageSize = 20
+
+// Validate the browse filters and return them as a models.SnippetFilter
+func (form *snippetBrowseForm) filter() models.SnippetFilter {
+	filter := models.SnippetFilter{
+		Author: form.Author,
+		Cursor: form.Cursor,
+		Limit:  browseSnippetsPageSize,
+	}
+
+	form.CheckField(form.Author == "" || primitive.IsValidObjectID(form.Author), "author", "This field must be a valid user ID")
+
+	// Both dates are inclusive, so the range ends at the start of the day
+	// after the "to" date
+	if form.From != "" {
+		from, err := time.Parse(time.DateOnly, form.From)
+		form.CheckField(err == nil, "from", "This field must be a valid date")
+		filter.From = from
+	}
+
+	if form.To != "" {
+		to, err := time.Parse(time.DateOnly, form.To)
+		form.CheckField(err == nil, "to", "This field must be a valid date")
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	return filter
+}
+
+// Define a searchQuery struct to hold the query string parameters of the
+// search page
+type searchQuery struct {
+	Q    string `form:"q"`
+	Page int    `form:"page"`
+}
+
+// The number of snippets shown on one page of the search results
+const searchPageSize = 20
+
+// Define a tagQuery struct to hold the query string parameters of a tag page
+type tagQuery struct {
+	Page int `form:"page"`
+}
+
+// The number of snippets shown on one page of a tag page
+const tagPageSize = 20
+
+// The number of tags shown in the tag cloud of the home page
+const tagCloudSize = 30
+
+// Define an accountStarredQuery struct to hold the query string parameters of
+// the "Starred" page
+type accountStarredQuery struct {
+	Page int `form:"page"`
+}
+
+// The number of snippets shown on one page of the "Starred" page
+const accountStarredPageSize = 20
+
+// Define a webhookDeliveriesQuery struct to hold the query string parameters
+// of the "Webhook Deliveries" page
+type webhookDeliveriesQuery struct {
+	Page int `form:"page"`
+}
+
+// The number of deliveries shown on one page of the "Webhook Deliveries" page
+const webhookDeliveriesPageSize = 50
+
+// The home page shows the snippets which were starred the most during the
+// last mostStarredPeriod
+const (
+	mostStarredPeriod = 7 * 24 * time.Hour
+	mostStarredSize   = 5
+)
+
+// Define a snippetDiffQuery struct to hold the numbers of the two revisions
+// which are compared. Zero values mean the latest revision and the one before
+type snippetDiffQuery struct {
+	From int `form:"from"`
+	To   int `form:"to"`
+}
+
+// The number of unchanged lines shown around the changes of a diff
+const diffContextLines = 3
+
+// Define a snippetRevertForm struct to hold the revision a snippet is reverted to
+type snippetRevertForm struct {
+	Revision int `form:"revision"`
+}
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 	snippets, err := app.snippets.Latest()
 	if err != nil {
@@ -44,24 +420,157 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The most used tags of the public snippets are shown as a tag cloud
+	tags, err := app.snippets.TagCloud(tagCloudSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	mostStarred, err := app.stars.MostStarred(time.Now().Add(-mostStarredPeriod), mostStarredSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	// Call the newTemplateData() helper to get a templateData struct containing
-	// the 'default' data, and add the snippets slice to it
+	// the 'default' data, and add the snippets and the tags to it
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
+	data.TagCloud = newTagCloud(tags)
+	data.MostStarred = mostStarred
 	app.render(w, r, http.StatusOK, "home.tmpl", data)
 }
 
+func (app *application) snippetBrowse(w http.ResponseWriter, r *http.Request) {
+	var form snippetBrowseForm
+
+	err := app.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	filter := form.filter()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "browse.tmpl", data)
+		return
+	}
+
+	snippets, cursor, err := app.snippets.Browse(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Form = form
+
+	// Link to the next page, keeping the current filters
+	if cursor != "" {
+		query := r.URL.Query()
+		query.Set("cursor", cursor)
+		data.NextURL = "/snippets?" + query.Encode()
+	}
+
+	// Link back to the newest snippets, keeping the current filters
+	if form.Cursor != "" {
+		query := r.URL.Query()
+		query.Del("cursor")
+		data.FirstURL = "/snippets?" + query.Encode()
+	}
+
+	app.render(w, r, http.StatusOK, "browse.tmpl", data)
+}
+
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	var query searchQuery
+
+	err := app.formDecoder.Decode(&query, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = query
+
+	// Without a query only the search form is shown
+	if validator.NotBlank(query.Q) {
+		snippets, total, err := app.snippets.Search(query.Q, query.Page, searchPageSize)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Snippets = snippets
+		data.Pagination = newPagination(r, query.Page, searchPageSize, total)
+	}
+
+	app.render(w, r, http.StatusOK, "search.tmpl", data)
+}
+
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("tag")
+
+	// Only valid tags can be attached to snippets
+	if !validator.Matches(tag, validator.SlugRX) || !validator.MaxChars(tag, maxSnippetTagLen) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var query tagQuery
+
+	err := app.formDecoder.Decode(&query, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	snippets, total, err := app.snippets.ByTag(tag, query.Page, tagPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tag = tag
+	data.Snippets = snippets
+	data.Pagination = newPagination(r, query.Page, tagPageSize, total)
+
+	app.render(w, r, http.StatusOK, "tag.tmpl", data)
+}
+
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
 	// Use the SnippetModel's Get() method to retrieve the data for a
 	// specific record based on its ID. If no matching record is found,
-	// return a 404 Not Found response.
-	snippet, err := app.snippets.Get(id)
+	// or it is a private snippet of another user, return a 404 Not Found response.
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
+		switch {
+		case errors.Is(err, models.ErrBurned):
+			app.renderBurned(w, r)
+		case errors.Is(err, models.ErrNoRecord):
 			http.NotFound(w, r)
-		} else {
+		default:
 			app.serverError(w, r, err)
 		}
 		return
@@ -69,67 +578,1237 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
-	app.render(w, r, http.StatusOK, "view.tmpl", data)
-}
 
-func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+	// Ask for the passphrase instead of showing the content of a protected
+	// snippet which hasn't been unlocked yet
+	if !app.isUnlocked(r, snippet) {
+		data.Form = snippetUnlockForm{}
+		app.render(w, r, http.StatusOK, "unlock.tmpl", data)
+		return
+	}
 
-	// Initialize a new createSnippetForm instance and pass it to the template
-	data.Form = snippetCreateForm{
-		Expires: 365,
+	// A burn after reading snippet is deleted as it is shown. If another
+	// viewer was faster, this one gets the burned page
+	if snippet.BurnAfterReading {
+		// The GET pattern matches HEAD requests too, like those of link
+		// previews and monitors. They don't show the snippet, so they
+		// mustn't burn it
+		if r.Method != http.MethodGet {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		data.Snippet, err = app.snippets.Burn(id, app.authenticatedUserID(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrBurned):
+				app.renderBurned(w, r)
+			case errors.Is(err, models.ErrNoRecord):
+				http.NotFound(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		app.notifySnippet(r, models.EventSnippetExpired, data.Snippet)
+
+		app.render(w, r, http.StatusOK, "view.tmpl", data)
+		return
 	}
 
-	app.render(w, r, http.StatusOK, "create.tmpl", data)
+	app.renderSnippet(w, r, http.StatusOK, snippet, commentForm{})
 }
 
-func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
-	var form snippetCreateForm
-	// Call the Decode() method of the form decoder, passing in the current
-	// request and *a pointer* to our snippetCreateForm struct. This will
-	// essentially fill our struct with the relevant values from the HTML form.
-	// If there is a problem, we return a 400 Bad Request response to the client.
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var form snippetUnlockForm
 	err := app.decodePostForm(r, &form)
 	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(validator.NotBlank(form.Passphrase), "passphrase", "This field cannot be blank")
 
-	// Use the Valid() method to see if any of the checks failed
+	if form.Valid() {
+		err = app.snippets.Unlock(id, app.authenticatedUserID(r), form.Passphrase)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrNoRecord):
+				http.NotFound(w, r)
+				return
+			case errors.Is(err, models.ErrInvalidCredentials):
+				form.AddNonFieldError("Passphrase is incorrect")
+			default:
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
+	// Redisplay the unlock form if the passphrase is missing or wrong
 	if !form.Valid() {
 		data := app.newTemplateData(r)
+		data.Snippet = models.Snippet{ID: id}
 		data.Form = form
-		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "unlock.tmpl", data)
 		return
 	}
 
-	// Pass the data to the SnippetModel.Insert() method, receiving the
-	// ID of the new record back
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	// Remember in the session that this snippet (and only this one) has been
+	// unlocked, so the passphrase isn't asked again
+	app.sessionManager.Put(r.Context(), unlockedSnippetKey(id), true)
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetCommentPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// Only snippets whose content the user can read can be commented on
+	snippet, ok := app.readableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	var form commentForm
+	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.serverError(w, r, err)
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Use the Put() method to add a string value ("Snippet successfully
-	// created!") and the corresponding key ("flash") to the session data
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	// Replies are possible to comments on the same snippet, which aren't
+	// replies themselves
+	if form.Parent != "" {
+		parent, err := app.comments.Get(form.Parent)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.clientError(w, http.StatusBadRequest)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
 
-	// Convert id to string, if it exist in ObjectID
-	objectID, ok := id.(primitive.ObjectID)
-	if !ok {
-		app.serverError(w, r, fmt.Errorf("can't find ObjectID"))
+		if parent.SnippetID != id || parent.ParentID != "" {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Comments can be about a line of the main file of the snippet
+	lines := lineCount(snippet.Content)
+
+	form.CheckField(validator.NotBlank(form.Body), "body", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Body, maxCommentChars), "body", fmt.Sprintf("This field cannot be more than %d characters long", maxCommentChars))
+	form.CheckField(form.Line >= 0 && form.Line <= lines, "line", fmt.Sprintf("This field must be a line number from 1 to %d", lines))
+
+	if !form.Valid() {
+		app.renderSnippet(w, r, http.StatusUnprocessableEntity, snippet, form)
 		return
 	}
-	idString := objectID.Hex()
 
-	// Redirect the user to the relevant page for the snippet
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", idString), http.StatusSeeOther)
+	commentID, err := app.comments.Insert(models.Comment{
+		SnippetID: id,
+		ParentID:  form.Parent,
+		Line:      form.Line,
+		Body:      form.Body,
+		UserID:    app.authenticatedUserID(r),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment added!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comment-%s", id, commentID), http.StatusSeeOther)
+}
+
+func (app *application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	comment, err := app.comments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	snippet, err := app.snippets.Get(comment.SnippetID, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// A comment can be deleted by its author and by the owner of the snippet
+	userID := app.authenticatedUserID(r)
+	if comment.UserID != userID && snippet.UserID != userID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	// The replies to the comment are deleted with it
+	err = app.comments.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment deleted!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s#comments", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrBurned):
+			app.clientError(w, http.StatusGone)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The content of protected snippets is sent only after they have been
+	// unlocked on the snippet page. Burn after reading snippets can be read
+	// only once, on the snippet page
+	if !app.isUnlocked(r, snippet) || snippet.BurnAfterReading {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	file, ok := requestedFile(r, snippet)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Send the content as plain text, which browsers must not try to sniff
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write([]byte(file.Content))
+}
+
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrBurned):
+			app.clientError(w, http.StatusGone)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The content of protected snippets is sent only after they have been
+	// unlocked on the snippet page. Burn after reading snippets can be read
+	// only once, on the snippet page
+	if !app.isUnlocked(r, snippet) || snippet.BurnAfterReading {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	file, ok := requestedFile(r, snippet)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Ask the browser to save the content as a file instead of showing it
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": file.Name})
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Write([]byte(file.Content))
+}
+
+func (app *application) snippetZip(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snippet, ok := app.readableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	// Write the archive to a buffer first, so that an error can still be
+	// reported with a proper status code
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+
+	for _, file := range snippetFiles(snippet) {
+		header := &zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: snippet.Created,
+		}
+
+		f, err := archive.CreateHeader(header)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		_, err = f.Write([]byte(file.Content))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err := archive.Close()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": slugify(snippet.Title) + ".zip"})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", disposition)
+	buf.WriteTo(w)
+}
+
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snippet, ok := app.readableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.revisions.All(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	app.render(w, r, http.StatusOK, "history.tmpl", data)
+}
+
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var query snippetDiffQuery
+	err := app.formDecoder.Decode(&query, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, ok := app.readableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.revisions.All(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if len(revisions) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// By default the latest revision is compared with the one before it
+	if query.To == 0 {
+		query.To = revisions[0].Number
+	}
+	if query.From == 0 {
+		query.From = max(query.To-1, 1)
+	}
+
+	from, fromFound := findRevision(revisions, query.From)
+	to, toFound := findRevision(revisions, query.To)
+	if !fromFound || !toFound {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.Diff = &revisionDiff{
+		From:  from,
+		To:    to,
+		Files: diffRevisions(from, to),
+	}
+	app.render(w, r, http.StatusOK, "diff.tmpl", data)
+}
+
+func (app *application) snippetRevertPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var form snippetRevertForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Only the owner of the snippet is allowed to revert it
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	revision, err := app.revisions.Get(id, form.Revision)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Restore the content of the revision and keep the other settings.
+	// Snippets created before visibility levels were added are public
+	snippet.Title = revision.Title
+	snippet.Content = revision.Content
+	snippet.Language = revision.Language
+	snippet.Filename = revision.Filename
+	snippet.Files = revision.Files
+	if snippet.Visibility == "" {
+		snippet.Visibility = models.VisibilityPublic
+	}
+
+	err = app.snippets.Update(snippet)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrNotOwner):
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The reverted content becomes a new revision, so nothing is lost
+	number, err := app.revisions.Insert(snippet, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.notifySnippet(r, models.EventSnippetUpdated, snippet)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet reverted to revision %d, saved as revision %d!", revision.Number, number))
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%s/history", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetForkPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// The content of protected snippets can be copied only after they have
+	// been unlocked, and burn after reading snippets not at all
+	source, ok := app.readableSnippet(w, r, id)
+	if !ok {
+		return
+	}
+
+	// The fork gets the default lifetime of new snippets. The model refuses
+	// to fork a snippet which has expired in the meantime
+	expires := time.Now().Add(expiryDurations[defaultExpiry])
+	forkID, err := app.snippets.Fork(id, app.authenticatedUserID(r), expires)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Keep the copied content as the first revision of the fork, which
+	// expires with the fork
+	fork := source
+	fork.ID = forkID
+	fork.Expires = expires
+	_, err = app.revisions.Insert(fork, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The fork is a new snippet of the user, without the stars and forks of
+	// the original
+	fork.UserID = app.authenticatedUserID(r)
+	fork.Author = ""
+	fork.Created = time.Time{}
+	fork.ForkedFrom = source.ID
+	fork.Forks = 0
+	fork.Stars = 0
+	app.notifySnippet(r, models.EventSnippetCreated, fork)
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully forked!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", forkID), http.StatusSeeOther)
+}
+
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// Only snippets the user can see can be starred. Burn after reading
+	// snippets are gone once seen, so there is no point starring them
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if snippet.BurnAfterReading {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.stars.Star(app.authenticatedUserID(r), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet starred!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetUnstarPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// A star can be removed even if the snippet can't be seen anymore, so
+	// only the id is checked
+	if !primitive.IsValidObjectID(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := app.stars.Unstar(app.authenticatedUserID(r), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Star removed.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	// Initialize a new createSnippetForm instance and pass it to the template
+	data.Form = snippetCreateForm{
+		Visibility: models.VisibilityPublic,
+		Expires:    defaultExpiry,
+	}
+
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
+}
+
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+	// Call the Decode() method of the form decoder, passing in the current
+	// request and *a pointer* to our snippetCreateForm struct. This will
+	// essentially fill our struct with the relevant values from the HTML form.
+	// If there is a problem, we return a 400 Bad Request response to the client.
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Show the form again with a file row added or removed
+	if form.editFiles() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusOK, "create.tmpl", data)
+		return
+	}
+
+	form.validate()
+	form.CheckField(form.Expires != expiresKeep, "expires", "Only edited snippets can keep their expiry time")
+
+	// Use the Valid() method to see if any of the checks failed
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
+		return
+	}
+
+	// Create the snippet with the current user as the owner, receiving the
+	// ID of the new record back
+	snippet := form.snippet("", app.authenticatedUserID(r))
+	idString, err := app.createSnippet(r, snippet, form.Passphrase)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Use the Put() method to add a string value ("Snippet successfully
+	// created!") and the corresponding key ("flash") to the session data
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+
+	// Viewing a burn after reading snippet would delete it, so show its link
+	// to the author instead
+	if snippet.BurnAfterReading {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/created/%s", idString), http.StatusSeeOther)
+		return
+	}
+
+	// Redirect the user to the relevant page for the snippet
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", idString), http.StatusSeeOther)
+}
+
+func (app *application) snippetCreated(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrBurned):
+			app.renderBurned(w, r)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Only the owner of the snippet may see its link here
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	// Other snippets can simply be viewed
+	if !snippet.BurnAfterReading {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", id), http.StatusSeeOther)
+		return
+	}
+
+	// The link is shown in full, so it can be copied and sent to the reader
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Link = fmt.Sprintf("https://%s/snippet/view/%s", r.Host, id)
+
+	app.render(w, r, http.StatusOK, "created.tmpl", data)
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Only the owner of the snippet is allowed to edit it
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	// Snippets created before visibility levels were added are public
+	visibility := snippet.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+
+	// Reuse the create form, prefilled with the current snippet data. The
+	// current expiry time is kept unless the owner chooses another one
+	form := snippetCreateForm{
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Language:   snippet.Language,
+		Visibility: visibility,
+		Expires:    expiresKeep,
+		Filename:   snippet.Filename,
+		Tags:       strings.Join(snippet.Tags, ", "),
+	}
+	for _, file := range snippet.Files {
+		form.Files = append(form.Files, snippetFileForm{
+			Name:     file.Name,
+			Content:  file.Content,
+			Language: file.Language,
+		})
+	}
+	// The custom expiry time starts from the current one, but it is only
+	// used if the owner chooses it: it is rounded to the minute
+	if !snippet.Expires.IsZero() {
+		form.ExpiresAt = snippet.Expires.UTC().Format(expiresAtLayout)
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = form
+
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var form snippetCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Show the form again with a file row added or removed
+	if form.editFiles() {
+		data := app.newTemplateData(r)
+		data.Snippet = models.Snippet{ID: id}
+		data.Form = form
+		app.render(w, r, http.StatusOK, "create.tmpl", data)
+		return
+	}
+
+	form.validate()
+	form.CheckField(form.Expires != burnAfterReading, "expires", "Only new snippets can be burned after reading")
+
+	// Redisplay the edit form if any of the checks failed
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = models.Snippet{ID: id}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
+		return
+	}
+
+	// Update the snippet. Only the owner of the snippet is allowed to edit it
+	err = app.updateSnippet(r, form.snippet(id, app.authenticatedUserID(r)), form.Expires == expiresKeep)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrNotOwner):
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// Delete the snippet. The model refuses to remove a snippet which belongs
+	// to another user
+	err := app.deleteSnippet(r, id, app.authenticatedUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrNotOwner):
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) accountSnippets(w http.ResponseWriter, r *http.Request) {
+	var query accountSnippetsQuery
+
+	// Decode the query string parameters. Out of range values fall back to the
+	// defaults: the first page, sorted by creation time, without expired snippets
+	err := app.formDecoder.Decode(&query, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	if !validator.PermittedValue(query.Sort, models.SnippetSortFields...) {
+		query.Sort = "created"
+	}
+
+	snippets, total, err := app.snippets.ByOwner(app.authenticatedUserID(r), query.Page, accountSnippetsPageSize, query.Sort, query.Expired)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Form = query
+	data.Pagination = newPagination(r, query.Page, accountSnippetsPageSize, total)
+	app.render(w, r, http.StatusOK, "account_snippets.tmpl", data)
+}
+
+func (app *application) accountStarred(w http.ResponseWriter, r *http.Request) {
+	var query accountStarredQuery
+
+	err := app.formDecoder.Decode(&query, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	snippets, total, err := app.stars.Starred(app.authenticatedUserID(r), query.Page, accountStarredPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Pagination = newPagination(r, query.Page, accountStarredPageSize, total)
+
+	app.render(w, r, http.StatusOK, "account_starred.tmpl", data)
+}
+
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	// New tokens are read-only unless the user chooses otherwise
+	app.renderTokens(w, r, http.StatusOK, tokenForm{Scope: models.ScopeRead}, "")
+}
+
+func (app *application) accountTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form tokenForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	token, err := app.tokens.Insert(app.authenticatedUserID(r), form.Name, form.Scope)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The token is shown in the response instead of redirecting, since it
+	// is never stored and can't be shown later
+	app.renderTokens(w, r, http.StatusOK, tokenForm{Scope: models.ScopeRead}, token)
+}
+
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	err := app.tokens.Revoke(r.PathValue("id"), app.authenticatedUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrNotOwner):
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Token successfully revoked!")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *application) accountWebhooks(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, webhookForm{})
+}
+
+func (app *application) accountWebhookCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form webhookForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	_, err = app.webhooks.Insert(app.authenticatedUserID(r), form.URL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook successfully added!")
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+func (app *application) accountWebhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	err := app.webhooks.Delete(r.PathValue("id"), app.authenticatedUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		case errors.Is(err, models.ErrNotOwner):
+			app.clientError(w, http.StatusForbidden)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook successfully deleted!")
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+func (app *application) accountWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	var query webhookDeliveriesQuery
+
+	err := app.formDecoder.Decode(&query, r.URL.Query())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	deliveries, total, err := app.webhooks.Deliveries(app.authenticatedUserID(r), query.Page, webhookDeliveriesPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Deliveries = deliveries
+	data.Pagination = newPagination(r, query.Page, webhookDeliveriesPageSize, total)
+
+	app.render(w, r, http.StatusOK, "webhook_deliveries.tmpl", data)
+}
+
+func (app *application) collectionList(w http.ResponseWriter, r *http.Request) {
+	collections, err := app.collections.ByOwner(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collections = collections
+
+	app.render(w, r, http.StatusOK, "collections.tmpl", data)
+}
+
+func (app *application) collectionView(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// Private collections are only found for their owner
+	collection, err := app.collections.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The snippets which the viewer can't see, or which are gone, are left out
+	snippets, err := app.snippets.ByIDs(collection.SnippetIDs, app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.Snippets = snippets
+
+	app.render(w, r, http.StatusOK, "collection.tmpl", data)
+}
+
+func (app *application) collectionCreate(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = collectionForm{
+		Visibility: models.VisibilityPublic,
+	}
+
+	app.render(w, r, http.StatusOK, "collection_create.tmpl", data)
+}
+
+func (app *application) collectionCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form collectionForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "collection_create.tmpl", data)
+		return
+	}
+
+	id, err := app.collections.Insert(models.Collection{
+		Name:        form.Name,
+		Description: form.Description,
+		Visibility:  form.Visibility,
+		UserID:      app.authenticatedUserID(r),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully created!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) collectionEdit(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	collection, err := app.collections.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Only the owner of the collection is allowed to edit it
+	if collection.UserID != app.authenticatedUserID(r) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	// Reuse the create form, prefilled with the current collection data
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.Form = collectionForm{
+		Name:        collection.Name,
+		Description: collection.Description,
+		Visibility:  collection.Visibility,
+	}
+
+	app.render(w, r, http.StatusOK, "collection_create.tmpl", data)
+}
+
+func (app *application) collectionEditPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var form collectionForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Collection = models.Collection{ID: id}
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "collection_create.tmpl", data)
+		return
+	}
+
+	// The model refuses to change a collection which belongs to another user
+	err = app.collections.Update(models.Collection{
+		ID:          id,
+		Name:        form.Name,
+		Description: form.Description,
+		Visibility:  form.Visibility,
+		UserID:      app.authenticatedUserID(r),
+	})
+	if err != nil {
+		app.collectionError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) collectionDeletePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	// The snippets of the collection are kept
+	err := app.collections.Delete(id, app.authenticatedUserID(r))
+	if err != nil {
+		app.collectionError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection successfully deleted!")
+
+	http.Redirect(w, r, "/collections", http.StatusSeeOther)
+}
+
+func (app *application) collectionAddPost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || !primitive.IsValidObjectID(form.SnippetID) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Only snippets the user can see can be added. Burn after reading
+	// snippets are gone once seen, so there is no point keeping them
+	snippet, err := app.snippets.Get(form.SnippetID, app.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.NotFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if snippet.BurnAfterReading {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.collections.AddSnippet(id, app.authenticatedUserID(r), form.SnippetID)
+	if err != nil {
+		app.collectionError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet added to the collection!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) collectionRemovePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || !primitive.IsValidObjectID(form.SnippetID) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Only the reference is removed, the snippet itself is kept
+	err = app.collections.RemoveSnippet(id, app.authenticatedUserID(r), form.SnippetID)
+	if err != nil {
+		app.collectionError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet removed from the collection!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", id), http.StatusSeeOther)
+}
+
+func (app *application) collectionMovePost(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var form collectionSnippetForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil || !primitive.IsValidObjectID(form.SnippetID) || !validator.PermittedValue(form.Offset, -1, 1) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.collections.MoveSnippet(id, app.authenticatedUserID(r), form.SnippetID, form.Offset)
+	if err != nil {
+		app.collectionError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%s", id), http.StatusSeeOther)
 }
 
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
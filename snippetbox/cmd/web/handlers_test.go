@@ -1,11 +1,16 @@
 package main
 
 import (
+	"archive/zip"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models/mocks"
 )
 
 func TestPing(t *testing.T) {
@@ -48,6 +53,11 @@ func TestSnippetView(t *testing.T) {
 			urlPath:  "/snippet/view/222222222222222222222222",
 			wantCode: http.StatusNotFound,
 		},
+		{
+			name:     "Private snippet of another user",
+			urlPath:  "/snippet/view/444444444444444444444444",
+			wantCode: http.StatusNotFound,
+		},
 		{
 			name:     "Negative ID",
 			urlPath:  "/snippet/view/-1",
@@ -198,3 +208,1810 @@ func TestUserSignup(t *testing.T) {
 		})
 	}
 }
+
+func TestSnippetEdit(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users are redirected to the login page
+	code, headers, _ := ts.get(t, "/snippet/edit/111111111111111111111111")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t)
+
+	// The form keeps the current expiry time, so that saving it without
+	// touching the expiry doesn't change the lifetime of the snippet. The
+	// custom expiry time starts from the current one
+	snippet, err := app.snippets.Get("111111111111111111111111", "111111111111111111111111")
+	assert.NilError(t, err)
+
+	code, _, body := ts.get(t, "/snippet/edit/111111111111111111111111")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<input type='radio' name='expires' value='keep' checked>")
+	assert.StringContains(t, body, "<input type='radio' name='expires' value='custom' >")
+	assert.StringContains(t, body, "<input type='datetime-local' name='expires_at' value='"+snippet.Expires.UTC().Format(expiresAtLayout)+"'>")
+
+	_, _, body = ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		title       string
+		expires     string
+		wantCode    int
+		wantBody    string
+		wantExpires time.Time
+	}{
+		{
+			name:     "Own snippet",
+			urlPath:  "/snippet/edit/111111111111111111111111",
+			title:    "An old silent pond",
+			expires:  "7d",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			// The expiry time isn't rounded to the minute of the form, nor
+			// checked to be in the future, as it could pass while editing
+			name:        "Unchanged expiry",
+			urlPath:     "/snippet/edit/111111111111111111111111",
+			title:       "An old silent pond",
+			expires:     "keep",
+			wantCode:    http.StatusSeeOther,
+			wantExpires: snippet.Expires,
+		},
+		{
+			name:     "Foreign snippet",
+			urlPath:  "/snippet/edit/333333333333333333333333",
+			title:    "A frog jumps into the pond",
+			expires:  "7d",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/snippet/edit/222222222222222222222222",
+			title:    "Nothing",
+			expires:  "7d",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Empty title",
+			urlPath:  "/snippet/edit/111111111111111111111111",
+			title:    "",
+			expires:  "7d",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "<form action='/snippet/edit/111111111111111111111111' method='POST'>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", "Some content")
+			form.Add("visibility", "public")
+			form.Add("expires", tt.expires)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+
+			// The expiry of the updated snippet is queued for its webhooks,
+			// in place of the one queued before
+			if !tt.wantExpires.IsZero() {
+				var expiries []time.Time
+				for _, delivery := range app.webhooks.(*mocks.WebhookModel).Enqueued() {
+					if delivery.Event == models.EventSnippetExpired {
+						expiries = append(expiries, delivery.NextAttempt)
+					}
+				}
+				assert.Equal(t, len(expiries), 1)
+				assert.Equal(t, expiries[0].Equal(tt.wantExpires), true)
+			}
+		})
+	}
+}
+
+func TestSnippetDelete(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+	}{
+		{
+			name:     "Own snippet",
+			urlPath:  "/snippet/delete/111111111111111111111111",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Foreign snippet",
+			urlPath:  "/snippet/delete/333333333333333333333333",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/snippet/delete/222222222222222222222222",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestAccountSnippets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users are redirected to the login page
+	code, headers, _ := ts.get(t, "/account/snippets")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/account/snippets?sort=title&expired=true")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "An old silent pond")
+	assert.StringContains(t, body, "<option value='title' selected>")
+	assert.StringContains(t, body, "Page 1 of 1")
+}
+
+func TestSnippetBrowse(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "No filters",
+			urlPath:  "/snippets",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond",
+		},
+		{
+			name:     "Date range",
+			urlPath:  "/snippets?from=2024-01-01&to=2024-12-31",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond",
+		},
+		{
+			name:     "Other author",
+			urlPath:  "/snippets?author=222222222222222222222222",
+			wantCode: http.StatusOK,
+			wantBody: "No snippets match the filters.",
+		},
+		{
+			name:     "Later page",
+			urlPath:  "/snippets?author=111111111111111111111111&from=2024-01-01&cursor=abc",
+			wantCode: http.StatusOK,
+			wantBody: "<a href='/snippets?author=111111111111111111111111&amp;from=2024-01-01'>&larr; Newest</a>",
+		},
+		{
+			name:     "Invalid author",
+			urlPath:  "/snippets?author=foo",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be a valid user ID",
+		},
+		{
+			name:     "Invalid date",
+			urlPath:  "/snippets?from=01.01.2024",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be a valid date",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		urlPath     string
+		wantBody    string
+		notWantBody string
+	}{
+		{
+			name:     "Empty query",
+			urlPath:  "/search",
+			wantBody: "<input type='search' name='q' value=''",
+		},
+		{
+			name:     "Match",
+			urlPath:  "/search?q=silent",
+			wantBody: "An old <mark>silent</mark> pond",
+		},
+		{
+			name:     "No match",
+			urlPath:  "/search?q=frog",
+			wantBody: "Nothing matches your search.",
+		},
+		{
+			// The content of a protected snippet mustn't be shown without
+			// its passphrase
+			name:        "Protected snippet",
+			urlPath:     "/search?q=lightning",
+			wantBody:    "Nothing matches your search.",
+			notWantBody: "Lightning flash...",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, tt.wantBody)
+
+			if tt.notWantBody != "" {
+				assert.Equal(t, strings.Contains(body, tt.notWantBody), false)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		language   string
+		visibility string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:       "Detected language",
+			language:   "",
+			visibility: "public",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Chosen language",
+			language:   "go",
+			visibility: "public",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Unsupported language",
+			language:   "cobol",
+			visibility: "public",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must be one of the supported languages",
+		},
+		{
+			name:       "Private",
+			language:   "go",
+			visibility: "private",
+			wantCode:   http.StatusSeeOther,
+		},
+		{
+			name:       "Invalid visibility",
+			language:   "go",
+			visibility: "secret",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field must equal public, unlisted or private",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Hello")
+			form.Add("content", "package main\n\nfunc main() {}\n")
+			form.Add("language", tt.language)
+			form.Add("visibility", tt.visibility)
+			form.Add("expires", "7d")
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantBody        string
+		wantDisposition string
+	}{
+		{
+			name:     "Raw",
+			urlPath:  "/snippet/raw/111111111111111111111111",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond...",
+		},
+		{
+			name:            "Download",
+			urlPath:         "/snippet/download/111111111111111111111111",
+			wantCode:        http.StatusOK,
+			wantBody:        "An old silent pond...",
+			wantDisposition: `attachment; filename=an-old-silent-pond.txt`,
+		},
+		{
+			name:     "Raw non-existent ID",
+			urlPath:  "/snippet/raw/222222222222222222222222",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Download non-existent ID",
+			urlPath:  "/snippet/download/222222222222222222222222",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, headers, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, body, tt.wantBody)
+				assert.Equal(t, headers.Get("Content-Type"), "text/plain; charset=utf-8")
+				assert.Equal(t, headers.Get("X-Content-Type-Options"), "nosniff")
+				assert.Equal(t, headers.Get("Content-Disposition"), tt.wantDisposition)
+			}
+		})
+	}
+}
+
+func TestSnippetUnlock(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	const urlPath = "/snippet/view/555555555555555555555555"
+
+	// The content is hidden behind the unlock form
+	code, _, body := ts.get(t, urlPath)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<form action='/snippet/unlock/555555555555555555555555' method='POST' novalidate>")
+	if strings.Contains(body, "Lightning flash...") {
+		t.Errorf("got: %q; expected the content to be hidden", body)
+	}
+
+	code, _, _ = ts.get(t, "/snippet/raw/555555555555555555555555")
+	assert.Equal(t, code, http.StatusForbidden)
+
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name       string
+		passphrase string
+		wantCode   int
+		wantBody   string
+	}{
+		{
+			name:       "Empty passphrase",
+			passphrase: "",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "This field cannot be blank",
+		},
+		{
+			name:       "Wrong passphrase",
+			passphrase: "open barley",
+			wantCode:   http.StatusUnprocessableEntity,
+			wantBody:   "Passphrase is incorrect",
+		},
+		{
+			name:       "Right passphrase",
+			passphrase: "open sesame",
+			wantCode:   http.StatusSeeOther,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("passphrase", tt.passphrase)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/snippet/unlock/555555555555555555555555", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	// Once unlocked, the content is shown for the rest of the session
+	code, _, body = ts.get(t, urlPath)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Lightning flash...")
+
+	code, _, body = ts.get(t, "/snippet/raw/555555555555555555555555")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body, "Lightning flash...")
+}
+
+func TestSnippetBurn(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "First view",
+			urlPath:  "/snippet/view/666666666666666666666666",
+			wantCode: http.StatusOK,
+			wantBody: "This snippet has now been burned",
+		},
+		{
+			name:     "Burned",
+			urlPath:  "/snippet/view/777777777777777777777777",
+			wantCode: http.StatusGone,
+			wantBody: "This snippet has been burned",
+		},
+		{
+			name:     "Raw",
+			urlPath:  "/snippet/raw/666666666666666666666666",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Raw burned",
+			urlPath:  "/snippet/raw/777777777777777777777777",
+			wantCode: http.StatusGone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	// The author is sent to the confirmation page with the one-time link
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("title", "Secret")
+	form.Add("content", "The password is swordfish")
+	form.Add("visibility", "unlisted")
+	form.Add("expires", "burn")
+	form.Add("csrf_token", validCSRFToken)
+
+	code, headers, _ := ts.postForm(t, "/snippet/create", form)
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/snippet/created/666666666666666666666666")
+
+	code, _, body = ts.get(t, "/snippet/created/666666666666666666666666")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "it works exactly once")
+	assert.StringContains(t, body, "/snippet/view/666666666666666666666666")
+
+	// Existing snippets can't be turned into one-time snippets
+	_, _, body = ts.get(t, "/snippet/edit/111111111111111111111111")
+	form.Set("csrf_token", extractCSRFToken(t, body))
+
+	code, _, body = ts.postForm(t, "/snippet/edit/111111111111111111111111", form)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Only new snippets can be burned after reading")
+}
+
+// Link previews and monitors send HEAD requests, which must not burn the
+// snippet. Burning it queues its expiry for the webhooks, so no event must be
+// queued
+func TestSnippetBurnHead(t *testing.T) {
+	for _, urlPath := range []string{"/snippet/view/666666666666666666666666", "/api/v1/snippets/666666666666666666666666"} {
+		t.Run(urlPath, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, _, body := ts.request(t, http.MethodHead, urlPath, "", nil)
+			assert.Equal(t, code, http.StatusOK)
+			assert.Equal(t, body, "")
+
+			assert.Equal(t, len(app.webhooks.(*mocks.WebhookModel).Enqueued()), 0)
+		})
+	}
+}
+
+func TestSnippetCreateExpiry(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name      string
+		expires   string
+		expiresAt string
+		wantCode  int
+		wantBody  string
+	}{
+		{
+			name:     "Minutes",
+			expires:  "10m",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Never",
+			expires:  "never",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:      "Custom",
+			expires:   "custom",
+			expiresAt: time.Now().UTC().Add(48 * time.Hour).Format("2006-01-02T15:04"),
+			wantCode:  http.StatusSeeOther,
+		},
+		{
+			name:      "Custom in the past",
+			expires:   "custom",
+			expiresAt: "2020-01-01T10:00",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must be a date and time in the future",
+		},
+		{
+			name:      "Custom malformed",
+			expires:   "custom",
+			expiresAt: "tomorrow",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantBody:  "This field must be a date and time in the future",
+		},
+		{
+			name:     "Unchanged",
+			expires:  "keep",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Only edited snippets can keep their expiry time",
+		},
+		{
+			name:     "Unknown option",
+			expires:  "30d",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be one of the listed expiry options",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Token")
+			form.Add("content", "abc123")
+			form.Add("visibility", "unlisted")
+			form.Add("expires", tt.expires)
+			form.Add("expires_at", tt.expiresAt)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetHistory(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "History",
+			urlPath:  "/snippet/111111111111111111111111/history",
+			wantCode: http.StatusOK,
+			wantBody: []string{"<td>#2</td>", "<td>An old pond</td>"},
+		},
+		{
+			name:     "Latest changes",
+			urlPath:  "/snippet/111111111111111111111111/diff",
+			wantCode: http.StatusOK,
+			wantBody: []string{
+				"@@ -1,1 &#43;1,1 @@",
+				"<span class='diff-line diff-del'>-An old pond</span>",
+				"<span class='diff-line diff-add'>&#43;An old silent pond...</span>",
+			},
+		},
+		{
+			name:     "Same revision",
+			urlPath:  "/snippet/111111111111111111111111/diff?from=2&to=2",
+			wantCode: http.StatusOK,
+			wantBody: []string{"The content of these revisions is the same."},
+		},
+		{
+			name:     "Non-existent revision",
+			urlPath:  "/snippet/111111111111111111111111/diff?from=1&to=5",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Protected snippet",
+			urlPath:  "/snippet/555555555555555555555555/history",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/snippet/222222222222222222222222/history",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown page",
+			urlPath:  "/snippet/111111111111111111111111/changes",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+}
+
+func TestSnippetRevert(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		revision string
+		wantCode int
+	}{
+		{
+			name:     "Own snippet",
+			urlPath:  "/snippet/revert/111111111111111111111111",
+			revision: "1",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Non-existent revision",
+			urlPath:  "/snippet/revert/111111111111111111111111",
+			revision: "7",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Foreign snippet",
+			urlPath:  "/snippet/revert/333333333333333333333333",
+			revision: "1",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("revision", tt.revision)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestSnippetFork(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The original shows its fork count, and the fork where it comes from
+	_, _, body := ts.get(t, "/snippet/view/111111111111111111111111")
+	assert.StringContains(t, body, "Forks: 1")
+
+	_, _, body = ts.get(t, "/snippet/view/333333333333333333333333")
+	assert.StringContains(t, body, "Forked from <a href='/snippet/view/111111111111111111111111'>#111111111111111111111111</a>")
+
+	ts.login(t)
+
+	_, _, body = ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Foreign snippet",
+			urlPath:      "/snippet/fork/333333333333333333333333",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/888888888888888888888888",
+		},
+		{
+			name:     "Locked snippet",
+			urlPath:  "/snippet/fork/555555555555555555555555",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Burn after reading snippet",
+			urlPath:  "/snippet/fork/666666666666666666666666",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Private snippet of another user",
+			urlPath:  "/snippet/fork/444444444444444444444444",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent or expired snippet",
+			urlPath:  "/snippet/fork/222222222222222222222222",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestMultiFileSnippet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Every file gets an anchor, linked from the list of files
+	code, _, body := ts.get(t, "/snippet/view/aaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.Equal(t, code, http.StatusOK)
+	for _, name := range []string{"main.go", "go.mod", "README.md"} {
+		assert.StringContains(t, body, "<a href='#file-"+name+"'>"+name+"</a>")
+		assert.StringContains(t, body, "<div class='file' id='file-"+name+"'>")
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Main file",
+			urlPath:  "/snippet/raw/aaaaaaaaaaaaaaaaaaaaaaaa",
+			wantCode: http.StatusOK,
+			wantBody: "package main\n\nfunc main() {}",
+		},
+		{
+			name:     "Other file",
+			urlPath:  "/snippet/raw/aaaaaaaaaaaaaaaaaaaaaaaa?file=go.mod",
+			wantCode: http.StatusOK,
+			wantBody: "module hello",
+		},
+		{
+			name:     "Non-existent file",
+			urlPath:  "/snippet/raw/aaaaaaaaaaaaaaaaaaaaaaaa?file=go.sum",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	// The zip archive holds all the files
+	code, headers, body := ts.get(t, "/snippet/zip/aaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, headers.Get("Content-Type"), "application/zip")
+	assert.Equal(t, headers.Get("Content-Disposition"), "attachment; filename=hello-module.zip")
+
+	archive, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, strings.Join(names, ","), "main.go,go.mod,README.md")
+
+	code, _, _ = ts.get(t, "/snippet/zip/555555555555555555555555")
+	assert.Equal(t, code, http.StatusForbidden)
+}
+
+func TestSnippetCreateFiles(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Add file",
+			fields:   map[string]string{"add_file": "true"},
+			wantCode: http.StatusOK,
+			wantBody: "<input type='text' name='files[0].name' value=''>",
+		},
+		{
+			name: "Remove file",
+			fields: map[string]string{
+				"filename":         "main.go",
+				"files[0].name":    "go.mod",
+				"files[0].content": "module hello",
+				"files[1].name":    "config.yaml",
+				"files[1].content": "port: 4000",
+				"remove_file":      "1",
+			},
+			wantCode: http.StatusOK,
+			wantBody: "<input type='text' name='files[0].name' value='config.yaml'>",
+		},
+		{
+			name: "Valid files",
+			fields: map[string]string{
+				"filename":         "main.go",
+				"files[0].name":    "go.mod",
+				"files[0].content": "module hello",
+			},
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name: "Unnamed main file",
+			fields: map[string]string{
+				"files[0].name":    "go.mod",
+				"files[0].content": "module hello",
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank when the snippet has more files",
+		},
+		{
+			name: "Duplicate name",
+			fields: map[string]string{
+				"filename":         "main.go",
+				"files[0].name":    "main.go",
+				"files[0].content": "package main",
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This file name is already used",
+		},
+		{
+			name: "Path as name",
+			fields: map[string]string{
+				"filename":         "main.go",
+				"files[0].name":    "../etc/passwd",
+				"files[0].content": "root",
+			},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must be a file name without spaces or slashes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Hello module")
+			form.Add("content", "package main\n\nfunc main() {}\n")
+			form.Add("visibility", "public")
+			form.Add("expires", "7d")
+			form.Add("csrf_token", validCSRFToken)
+			for key, value := range tt.fields {
+				form.Add(key, value)
+			}
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestTagView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "Tagged snippets",
+			urlPath:  "/tags/haiku",
+			wantCode: http.StatusOK,
+			wantBody: "An old silent pond",
+		},
+		{
+			name:     "Unused tag",
+			urlPath:  "/tags/poem",
+			wantCode: http.StatusOK,
+			wantBody: "There are no snippets with this tag.",
+		},
+		{
+			name:     "Invalid tag",
+			urlPath:  "/tags/Haiku",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("Tags on the view page and the home page", func(t *testing.T) {
+		_, _, body := ts.get(t, "/snippet/view/111111111111111111111111")
+		assert.StringContains(t, body, "<a href='/tags/nature' class='tag'>nature</a>")
+
+		_, _, body = ts.get(t, "/")
+		assert.StringContains(t, body, "<a href='/tags/haiku' class='tag-5' title='3 snippets'>haiku</a>")
+		assert.StringContains(t, body, "<a href='/tags/nature' class='tag-1' title='1 snippets'>nature</a>")
+	})
+}
+
+func TestSnippetCreateTags(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		tags     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "No tags",
+			tags:     "",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Valid tags",
+			tags:     " Go, http-server,",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Too many",
+			tags:     "a, b, c, d, e, f",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "A snippet can&#39;t have more than 5 tags",
+		},
+		{
+			name:     "Repeated",
+			tags:     "go, GO",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Every tag must be used once",
+		},
+		{
+			name:     "Not a slug",
+			tags:     "http server",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Tags must be lowercase letters and digits, which may be joined with dashes",
+		},
+		{
+			name:     "Too long",
+			tags:     strings.Repeat("a", 31),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "Tags cannot be more than 30 characters long",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Server")
+			form.Add("content", "package main")
+			form.Add("visibility", "public")
+			form.Add("expires", "1d")
+			form.Add("tags", tt.tags)
+			form.Add("csrf_token", validCSRFToken)
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetStar(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users see the star count, and the most starred snippets on
+	// the home page, but can't star
+	_, _, body := ts.get(t, "/snippet/view/333333333333333333333333")
+	assert.StringContains(t, body, "&#9733; 1")
+
+	_, _, body = ts.get(t, "/")
+	assert.StringContains(t, body, "Most Starred This Week")
+	assert.StringContains(t, body, "A frog jumps into the pond")
+
+	ts.login(t)
+
+	// A starred snippet offers to remove the star, the others to add one
+	_, _, body = ts.get(t, "/snippet/view/333333333333333333333333")
+	assert.StringContains(t, body, "<form action='/snippet/333333333333333333333333/unstar' method='POST'>")
+
+	_, _, body = ts.get(t, "/snippet/view/111111111111111111111111")
+	assert.StringContains(t, body, "<form action='/snippet/111111111111111111111111/star' method='POST'>")
+
+	_, _, body = ts.get(t, "/account/starred")
+	assert.StringContains(t, body, "<a href='/snippet/view/333333333333333333333333'>A frog jumps into the pond</a>")
+
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:         "Star",
+			urlPath:      "/snippet/111111111111111111111111/star",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/111111111111111111111111",
+		},
+		{
+			name:         "Unstar",
+			urlPath:      "/snippet/333333333333333333333333/unstar",
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/333333333333333333333333",
+		},
+		{
+			name:     "Burn after reading snippet",
+			urlPath:  "/snippet/666666666666666666666666/star",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Private snippet of another user",
+			urlPath:  "/snippet/444444444444444444444444/star",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent or expired snippet",
+			urlPath:  "/snippet/222222222222222222222222/star",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unstar invalid ID",
+			urlPath:  "/snippet/1.23/unstar",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Unknown action",
+			urlPath:  "/snippet/111111111111111111111111/like",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("csrf_token", validCSRFToken)
+
+			code, headers, _ := ts.postForm(t, tt.urlPath, form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+		})
+	}
+}
+
+func TestSnippetComments(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users can read the comments, and the lines they are about
+	// can be linked to
+	_, _, body := ts.get(t, "/snippet/view/111111111111111111111111")
+	assert.StringContains(t, body, `<span class="ln" id="L1"><a class="lnlinks" href="#L1">1</a></span>`)
+	assert.StringContains(t, body, "<a href='#L1'>line 1</a>")
+	assert.StringContains(t, body, "<p>What a quiet first line</p>")
+	assert.StringContains(t, body, "<div class='comment reply' id='comment-cccccccccccccccccccccc02'>")
+	assert.StringContains(t, body, "<a href='/user/login'>Login</a> to comment.")
+
+	ts.login(t)
+
+	// The owner of a snippet can delete all the comments on it, and other
+	// users only their own ones
+	_, _, body = ts.get(t, "/snippet/view/111111111111111111111111")
+	assert.StringContains(t, body, "<form action='/comment/delete/cccccccccccccccccccccc01' method='POST'>")
+
+	_, _, body = ts.get(t, "/snippet/view/333333333333333333333333")
+	assert.StringContains(t, body, "<form action='/comment/delete/cccccccccccccccccccccc04' method='POST'>")
+	if strings.Contains(body, "/comment/delete/cccccccccccccccccccccc03") {
+		t.Errorf("got a delete button for a comment of another user on a snippet of another user")
+	}
+
+	validCSRFToken := extractCSRFToken(t, body)
+
+	t.Run("Add", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			urlPath      string
+			body         string
+			line         string
+			parent       string
+			csrfToken    string
+			wantCode     int
+			wantLocation string
+			wantBody     string
+		}{
+			{
+				name:         "Comment",
+				urlPath:      "/snippet/comment/111111111111111111111111",
+				body:         "Lovely",
+				line:         "1",
+				csrfToken:    validCSRFToken,
+				wantCode:     http.StatusSeeOther,
+				wantLocation: "/snippet/view/111111111111111111111111#comment-cccccccccccccccccccccc05",
+			},
+			{
+				name:         "Reply",
+				urlPath:      "/snippet/comment/111111111111111111111111",
+				body:         "Indeed",
+				parent:       "cccccccccccccccccccccc01",
+				csrfToken:    validCSRFToken,
+				wantCode:     http.StatusSeeOther,
+				wantLocation: "/snippet/view/111111111111111111111111#comment-cccccccccccccccccccccc05",
+			},
+			{
+				name:      "Reply to a reply",
+				urlPath:   "/snippet/comment/111111111111111111111111",
+				body:      "Indeed",
+				parent:    "cccccccccccccccccccccc02",
+				csrfToken: validCSRFToken,
+				wantCode:  http.StatusBadRequest,
+			},
+			{
+				name:      "Reply to a comment on another snippet",
+				urlPath:   "/snippet/comment/111111111111111111111111",
+				body:      "Indeed",
+				parent:    "cccccccccccccccccccccc03",
+				csrfToken: validCSRFToken,
+				wantCode:  http.StatusBadRequest,
+			},
+			{
+				name:      "Blank",
+				urlPath:   "/snippet/comment/111111111111111111111111",
+				body:      " ",
+				csrfToken: validCSRFToken,
+				wantCode:  http.StatusUnprocessableEntity,
+				wantBody:  "This field cannot be blank",
+			},
+			{
+				name:      "Line after the end",
+				urlPath:   "/snippet/comment/111111111111111111111111",
+				body:      "Lovely",
+				line:      "2",
+				csrfToken: validCSRFToken,
+				wantCode:  http.StatusUnprocessableEntity,
+				wantBody:  "This field must be a line number from 1 to 1",
+			},
+			{
+				name:      "Invalid CSRF token",
+				urlPath:   "/snippet/comment/111111111111111111111111",
+				body:      "Lovely",
+				csrfToken: "wrongToken",
+				wantCode:  http.StatusBadRequest,
+			},
+			{
+				name:      "Locked snippet",
+				urlPath:   "/snippet/comment/555555555555555555555555",
+				body:      "Lovely",
+				csrfToken: validCSRFToken,
+				wantCode:  http.StatusForbidden,
+			},
+			{
+				name:      "Burn after reading snippet",
+				urlPath:   "/snippet/comment/666666666666666666666666",
+				body:      "Lovely",
+				csrfToken: validCSRFToken,
+				wantCode:  http.StatusForbidden,
+			},
+			{
+				name:      "Non-existent or expired snippet",
+				urlPath:   "/snippet/comment/222222222222222222222222",
+				body:      "Lovely",
+				csrfToken: validCSRFToken,
+				wantCode:  http.StatusNotFound,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("body", tt.body)
+				form.Add("line", tt.line)
+				form.Add("parent", tt.parent)
+				form.Add("csrf_token", tt.csrfToken)
+
+				code, headers, body := ts.postForm(t, tt.urlPath, form)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+				if tt.wantBody != "" {
+					assert.StringContains(t, body, tt.wantBody)
+				}
+			})
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			urlPath      string
+			wantCode     int
+			wantLocation string
+		}{
+			{
+				name:         "Comment on own snippet",
+				urlPath:      "/comment/delete/cccccccccccccccccccccc01",
+				wantCode:     http.StatusSeeOther,
+				wantLocation: "/snippet/view/111111111111111111111111#comments",
+			},
+			{
+				name:         "Own comment",
+				urlPath:      "/comment/delete/cccccccccccccccccccccc04",
+				wantCode:     http.StatusSeeOther,
+				wantLocation: "/snippet/view/333333333333333333333333#comments",
+			},
+			{
+				name:     "Comment of another user",
+				urlPath:  "/comment/delete/cccccccccccccccccccccc03",
+				wantCode: http.StatusForbidden,
+			},
+			{
+				name:     "Non-existent comment",
+				urlPath:  "/comment/delete/cccccccccccccccccccccc99",
+				wantCode: http.StatusNotFound,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("csrf_token", validCSRFToken)
+
+				code, headers, _ := ts.postForm(t, tt.urlPath, form)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+			})
+		}
+	})
+}
+
+func TestCollections(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anybody can see public collections, without the snippets they can't see
+	_, _, body := ts.get(t, "/collections/dddddddddddddddddddddd01")
+	assert.StringContains(t, body, "<h2>Pond poems</h2>")
+	assert.StringContains(t, body, "<a href='/snippet/view/111111111111111111111111'>An old silent pond</a>")
+	assert.StringContains(t, body, "<a href='/snippet/view/333333333333333333333333'>A frog jumps into the pond</a>")
+	if strings.Contains(body, "/snippet/view/444444444444444444444444") {
+		t.Errorf("got a private snippet of another user in the collection")
+	}
+	if strings.Contains(body, "/collections/dddddddddddddddddddddd01/edit") {
+		t.Errorf("got an edit link for an anonymous user")
+	}
+
+	code, _, _ := ts.get(t, "/collections/dddddddddddddddddddddd02")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, headers, _ := ts.get(t, "/collections")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t)
+
+	_, _, body = ts.get(t, "/collections")
+	assert.StringContains(t, body, "<a href='/collections/dddddddddddddddddddddd01'>Pond poems</a>")
+
+	_, _, body = ts.get(t, "/collections/dddddddddddddddddddddd01")
+	assert.StringContains(t, body, "<a href='/collections/dddddddddddddddddddddd01/edit'>Edit</a>")
+	assert.StringContains(t, body, "<form action='/collections/dddddddddddddddddddddd01/move' method='POST'>")
+
+	// Snippets can be added from their page to the collections which don't
+	// hold them yet
+	_, _, body = ts.get(t, "/snippet/view/333333333333333333333333")
+	assert.StringContains(t, body, "<span>In <a href='/collections/dddddddddddddddddddddd01'>Pond poems</a></span>")
+
+	_, _, body = ts.get(t, "/snippet/view/aaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.StringContains(t, body, "<form action='/collections/dddddddddddddddddddddd01/add' method='POST'>")
+
+	code, _, _ = ts.get(t, "/collections/dddddddddddddddddddddd02/edit")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	validCSRFToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		form         url.Values
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "Create",
+			urlPath:      "/collections/create",
+			form:         url.Values{"name": {"Frogs"}, "visibility": {"unlisted"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/dddddddddddddddddddddd03",
+		},
+		{
+			name:     "Create without a name",
+			urlPath:  "/collections/create",
+			form:     url.Values{"name": {" "}, "visibility": {"public"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field cannot be blank",
+		},
+		{
+			name:     "Create with an invalid visibility",
+			urlPath:  "/collections/create",
+			form:     url.Values{"name": {"Frogs"}, "visibility": {"secret"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: "This field must equal public, unlisted or private",
+		},
+		{
+			name:         "Edit",
+			urlPath:      "/collections/dddddddddddddddddddddd01/edit",
+			form:         url.Values{"name": {"Ponds"}, "visibility": {"private"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/dddddddddddddddddddddd01",
+		},
+		{
+			name:     "Edit a collection of another user",
+			urlPath:  "/collections/dddddddddddddddddddddd02/edit",
+			form:     url.Values{"name": {"Mine"}, "visibility": {"public"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:         "Add",
+			urlPath:      "/collections/dddddddddddddddddddddd01/add",
+			form:         url.Values{"snippet_id": {"aaaaaaaaaaaaaaaaaaaaaaaa"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/dddddddddddddddddddddd01",
+		},
+		{
+			name:     "Add a burn after reading snippet",
+			urlPath:  "/collections/dddddddddddddddddddddd01/add",
+			form:     url.Values{"snippet_id": {"666666666666666666666666"}},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Add a non-existent snippet",
+			urlPath:  "/collections/dddddddddddddddddddddd01/add",
+			form:     url.Values{"snippet_id": {"222222222222222222222222"}},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Add an invalid snippet ID",
+			urlPath:  "/collections/dddddddddddddddddddddd01/add",
+			form:     url.Values{"snippet_id": {"1.23"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Add to a collection of another user",
+			urlPath:  "/collections/dddddddddddddddddddddd02/add",
+			form:     url.Values{"snippet_id": {"111111111111111111111111"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:         "Move down",
+			urlPath:      "/collections/dddddddddddddddddddddd01/move",
+			form:         url.Values{"snippet_id": {"111111111111111111111111"}, "offset": {"1"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/dddddddddddddddddddddd01",
+		},
+		{
+			name:     "Move by an invalid offset",
+			urlPath:  "/collections/dddddddddddddddddddddd01/move",
+			form:     url.Values{"snippet_id": {"111111111111111111111111"}, "offset": {"2"}},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Move a snippet which isn't in the collection",
+			urlPath:  "/collections/dddddddddddddddddddddd01/move",
+			form:     url.Values{"snippet_id": {"aaaaaaaaaaaaaaaaaaaaaaaa"}, "offset": {"-1"}},
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "Remove",
+			urlPath:      "/collections/dddddddddddddddddddddd01/remove",
+			form:         url.Values{"snippet_id": {"333333333333333333333333"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections/dddddddddddddddddddddd01",
+		},
+		{
+			name:         "Delete",
+			urlPath:      "/collections/dddddddddddddddddddddd01/delete",
+			form:         url.Values{},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/collections",
+		},
+		{
+			name:     "Delete a collection of another user",
+			urlPath:  "/collections/dddddddddddddddddddddd02/delete",
+			form:     url.Values{},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Delete a non-existent collection",
+			urlPath:  "/collections/dddddddddddddddddddddd99/delete",
+			form:     url.Values{},
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Add("csrf_token", validCSRFToken)
+
+			code, headers, body := ts.postForm(t, tt.urlPath, tt.form)
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, headers.Get("Location"), tt.wantLocation)
+
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAccountTokens(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users are redirected to the login page
+	code, headers, _ := ts.get(t, "/account/tokens")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/account/tokens")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<td>CI</td>")
+	assert.StringContains(t, body, "<td>Dashboard</td>")
+	assert.StringContains(t, body, "<td>Never</td>")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	t.Run("Create", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			tokenName string
+			scope     string
+			wantCode  int
+			wantBody  string
+		}{
+			{
+				name:      "Valid token",
+				tokenName: "Deploy",
+				scope:     "read-write",
+				wantCode:  http.StatusOK,
+				wantBody:  "<code class='token'>sbx_new-token</code>",
+			},
+			{
+				name:      "Blank name",
+				tokenName: "",
+				scope:     "read",
+				wantCode:  http.StatusUnprocessableEntity,
+				wantBody:  "This field cannot be blank",
+			},
+			{
+				name:      "Invalid scope",
+				tokenName: "Deploy",
+				scope:     "admin",
+				wantCode:  http.StatusUnprocessableEntity,
+				wantBody:  "This field must equal read or read-write",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("name", tt.tokenName)
+				form.Add("scope", tt.scope)
+				form.Add("csrf_token", validCSRFToken)
+
+				code, _, body := ts.postForm(t, "/account/tokens/create", form)
+				assert.Equal(t, code, tt.wantCode)
+				assert.StringContains(t, body, tt.wantBody)
+			})
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			urlPath  string
+			wantCode int
+		}{
+			{
+				name:     "Own token",
+				urlPath:  "/account/tokens/revoke/eeeeeeeeeeeeeeeeeeeeee01",
+				wantCode: http.StatusSeeOther,
+			},
+			{
+				name:     "Foreign token",
+				urlPath:  "/account/tokens/revoke/eeeeeeeeeeeeeeeeeeeeee03",
+				wantCode: http.StatusForbidden,
+			},
+			{
+				name:     "Non-existent token",
+				urlPath:  "/account/tokens/revoke/eeeeeeeeeeeeeeeeeeeeee09",
+				wantCode: http.StatusNotFound,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("csrf_token", validCSRFToken)
+
+				code, _, _ := ts.postForm(t, tt.urlPath, form)
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	})
+}
+
+func TestAccountWebhooks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Anonymous users are redirected to the login page
+	code, headers, _ := ts.get(t, "/account/webhooks")
+	assert.Equal(t, code, http.StatusSeeOther)
+	assert.Equal(t, headers.Get("Location"), "/user/login")
+
+	ts.login(t)
+
+	code, _, body := ts.get(t, "/account/webhooks")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<td>https://chat.example.com/hooks/snippets</td>")
+	assert.StringContains(t, body, "<td><code>s3cret</code></td>")
+	validCSRFToken := extractCSRFToken(t, body)
+
+	t.Run("Create", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			url      string
+			wantCode int
+			wantBody string
+		}{
+			{
+				name:     "Valid URL",
+				url:      "https://example.com/hooks",
+				wantCode: http.StatusSeeOther,
+			},
+			{
+				name:     "Blank URL",
+				url:      "",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field cannot be blank",
+			},
+			{
+				name:     "Relative URL",
+				url:      "/hooks",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field must be an http or https URL",
+			},
+			{
+				name:     "Other scheme",
+				url:      "ftp://example.com/hooks",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field must be an http or https URL",
+			},
+			{
+				name:     "Public IP address",
+				url:      "http://93.184.215.14/hooks",
+				wantCode: http.StatusSeeOther,
+			},
+			{
+				name:     "Localhost",
+				url:      "http://localhost:8080/hooks",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field must be a URL on the public internet",
+			},
+			{
+				name:     "Loopback address",
+				url:      "http://127.0.0.1:4000/hooks",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field must be a URL on the public internet",
+			},
+			{
+				name:     "IPv6 loopback address",
+				url:      "http://[::1]/hooks",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field must be a URL on the public internet",
+			},
+			{
+				name:     "Private address",
+				url:      "https://10.0.0.7/hooks",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field must be a URL on the public internet",
+			},
+			{
+				name:     "Metadata service",
+				url:      "http://169.254.169.254/latest/meta-data/",
+				wantCode: http.StatusUnprocessableEntity,
+				wantBody: "This field must be a URL on the public internet",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("url", tt.url)
+				form.Add("csrf_token", validCSRFToken)
+
+				code, _, body := ts.postForm(t, "/account/webhooks/create", form)
+				assert.Equal(t, code, tt.wantCode)
+				assert.StringContains(t, body, tt.wantBody)
+			})
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			urlPath  string
+			wantCode int
+		}{
+			{
+				name:     "Own webhook",
+				urlPath:  "/account/webhooks/delete/ffffffffffffffffffffff01",
+				wantCode: http.StatusSeeOther,
+			},
+			{
+				name:     "Foreign webhook",
+				urlPath:  "/account/webhooks/delete/ffffffffffffffffffffff02",
+				wantCode: http.StatusForbidden,
+			},
+			{
+				name:     "Non-existent webhook",
+				urlPath:  "/account/webhooks/delete/ffffffffffffffffffffff09",
+				wantCode: http.StatusNotFound,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("csrf_token", validCSRFToken)
+
+				code, _, _ := ts.postForm(t, tt.urlPath, form)
+				assert.Equal(t, code, tt.wantCode)
+			})
+		}
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		code, _, body := ts.get(t, "/account/webhooks/deliveries")
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<td>snippet.created</td>")
+		assert.StringContains(t, body, "<td>204</td>")
+		assert.StringContains(t, body, "<td>502 unexpected status 502 Bad Gateway</td>")
+	})
+}
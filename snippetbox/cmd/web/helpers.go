@@ -6,10 +6,16 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 	"time"
 
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/diff"
+	syntax "github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/highlight"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // The serverError helper writes a log entry at Error level (including the request
@@ -65,10 +71,11 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 // struct initialized with the current year
 func (app *application) newTemplateData(r *http.Request) templateData {
 	return templateData{
-		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r),
+		CurrentYear:         time.Now().Year(),
+		Flash:               app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated:     app.isAuthenticated(r),
+		CSRFToken:           nosurf.Token(r),
+		AuthenticatedUserID: app.authenticatedUserID(r),
 	}
 }
 
@@ -110,3 +117,413 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 
 	return isAuthenticated
 }
+
+// Return the ID of the user making the current request, or the empty string
+// if the request is not from an authenticated user
+func (app *application) authenticatedUserID(r *http.Request) string {
+	id, ok := r.Context().Value(authenticatedUserIDContextKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return id
+}
+
+// Returns the session key which records that a protected snippet has been unlocked
+func unlockedSnippetKey(id string) string {
+	return "unlockedSnippet:" + id
+}
+
+// Return true if the content of a snippet can be shown to the user making the
+// request. That is the case if the snippet isn't protected by a passphrase, if
+// the user owns it, or if it has been unlocked during the current session
+func (app *application) isUnlocked(r *http.Request, snippet models.Snippet) bool {
+	if !snippet.IsProtected() {
+		return true
+	}
+
+	if id := app.authenticatedUserID(r); id != "" && id == snippet.UserID {
+		return true
+	}
+
+	return app.sessionManager.GetBool(r.Context(), unlockedSnippetKey(snippet.ID))
+}
+
+// Returns the file name the main file of a snippet is downloaded as. Unless
+// the author named the file, it is made of the title (see slugify) and the
+// file name extension of the snippet language
+func snippetFilename(snippet models.Snippet) string {
+	if snippet.Filename != "" {
+		return snippet.Filename
+	}
+	return slugify(snippet.Title) + "." + syntax.Extension(snippet.Language)
+}
+
+// Reduce a title to lowercase letters, digits and dashes, so that it can be
+// used as a file name
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	name := strings.TrimRight(b.String(), "-")
+	if len(name) > 50 {
+		name = strings.TrimRight(name[:50], "-")
+	}
+	if name == "" {
+		name = "snippet"
+	}
+
+	return name
+}
+
+// Returns all the files of a snippet, starting with the main one
+func snippetFiles(snippet models.Snippet) []models.File {
+	main := models.File{
+		Name:     snippetFilename(snippet),
+		Content:  snippet.Content,
+		Language: snippet.Language,
+	}
+	return append([]models.File{main}, snippet.Files...)
+}
+
+// Returns the number of lines of the content, counted like the highlighter
+// numbers them: a final newline doesn't start another line
+func lineCount(content string) int {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+}
+
+// Returns the file of the snippet chosen by the "file" query string
+// parameter, or the main file if there is none
+func requestedFile(r *http.Request, snippet models.Snippet) (models.File, bool) {
+	files := snippetFiles(snippet)
+
+	name := r.URL.Query().Get("file")
+	if name == "" {
+		return files[0], true
+	}
+
+	for _, file := range files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return models.File{}, false
+}
+
+// The renderBurned helper tells the visitor that the burn after reading
+// snippet they asked for has already been read, with a 410 Gone status
+func (app *application) renderBurned(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, http.StatusGone, "burned.tmpl", app.newTemplateData(r))
+}
+
+// The renderSnippet() helper renders the page of a snippet which can be read,
+// with its comments, whether the user starred it, the collections of the user
+// and the comment form
+func (app *application) renderSnippet(w http.ResponseWriter, r *http.Request, status int, snippet models.Snippet, form commentForm) {
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = form
+
+	// Show whether the user can star the snippet or remove their star
+	if app.isAuthenticated(r) {
+		starred, err := app.stars.IsStarred(app.authenticatedUserID(r), snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.IsStarred = starred
+	}
+
+	comments, err := app.comments.BySnippet(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.Comments = newCommentThreads(comments)
+
+	// The snippet can be added to the collections of the user
+	if app.isAuthenticated(r) {
+		data.Collections, err = app.collections.ByOwner(app.authenticatedUserID(r))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.render(w, r, status, "view.tmpl", data)
+}
+
+// The renderTokens() helper renders the "API Tokens" page with the tokens of
+// the user and the form for a new token. A token which was just created is
+// passed as newToken, to be shown once
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form tokenForm, newToken string) {
+	tokens, err := app.tokens.ByOwner(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.NewToken = newToken
+	data.Form = form
+
+	app.render(w, r, status, "tokens.tmpl", data)
+}
+
+// The renderWebhooks() helper renders the "Webhooks" page with the webhooks
+// of the user and the form for a new webhook
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form webhookForm) {
+	webhooks, err := app.webhooks.ByOwner(app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhooks = webhooks
+	data.Form = form
+
+	app.render(w, r, status, "webhooks.tmpl", data)
+}
+
+// The createSnippet() helper stores a new snippet and returns its ID. The
+// content is kept as the first revision of the snippet, unless it is burned
+// after reading: then it mustn't outlive the snippet in a revision. The
+// webhooks of the user are notified
+func (app *application) createSnippet(r *http.Request, snippet models.Snippet, passphrase string) (string, error) {
+	id, err := app.snippets.Insert(snippet, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	// Convert id to string, if it exist in ObjectID
+	objectID, ok := id.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("can't find ObjectID")
+	}
+	snippet.ID = objectID.Hex()
+
+	if !snippet.BurnAfterReading {
+		_, err = app.revisions.Insert(snippet, snippet.UserID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	app.notifySnippet(r, models.EventSnippetCreated, snippet)
+
+	return snippet.ID, nil
+}
+
+// The updateSnippet() helper changes a snippet of the user (snippet.UserID)
+// and keeps the new content as its next revision. If keepExpiry is true, the
+// snippet keeps its current expiry time instead of snippet.Expires. Returns
+// ErrNoRecord if there is no such snippet and ErrNotOwner if it belongs to
+// another user
+func (app *application) updateSnippet(r *http.Request, snippet models.Snippet, keepExpiry bool) error {
+	// Make sure the user owns the snippet before its current version is kept
+	// as a revision
+	current, err := app.snippets.Get(snippet.ID, snippet.UserID)
+	if err != nil {
+		return err
+	}
+
+	if current.UserID != snippet.UserID {
+		return models.ErrNotOwner
+	}
+
+	if keepExpiry {
+		snippet.Expires = current.Expires
+	}
+
+	if !current.BurnAfterReading {
+		err = app.recordBaselineRevision(current)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The model refuses to change a snippet which belongs to another user
+	err = app.snippets.Update(snippet)
+	if err != nil {
+		return err
+	}
+
+	// The webhooks get the snippet with the values which the update doesn't
+	// change
+	updated := snippet
+	updated.Created = current.Created
+	updated.Author = current.Author
+	updated.BurnAfterReading = current.BurnAfterReading
+	updated.ForkedFrom = current.ForkedFrom
+	updated.Forks = current.Forks
+	updated.Stars = current.Stars
+	app.notifySnippet(r, models.EventSnippetUpdated, updated)
+
+	if current.BurnAfterReading {
+		return nil
+	}
+
+	_, err = app.revisions.Insert(snippet, snippet.UserID)
+	return err
+}
+
+// The deleteSnippet() helper deletes a snippet of the user together with the
+// data which is of no use without it: its revisions, stars and comments, and
+// the references to it in collections. The webhooks of the user are notified
+func (app *application) deleteSnippet(r *http.Request, id string, userID string) error {
+	// Keep the snippet for the webhooks before it is gone. The model decides
+	// whether it can be deleted
+	snippet, err := app.snippets.Get(id, userID)
+	if err != nil {
+		snippet = models.Snippet{ID: id}
+	}
+	snippet.UserID = userID
+
+	err = app.snippets.Delete(id, userID)
+	if err != nil {
+		return err
+	}
+
+	app.notifySnippet(r, models.EventSnippetDeleted, snippet)
+
+	err = app.revisions.DeleteAll(id)
+	if err != nil {
+		return err
+	}
+
+	err = app.stars.DeleteAll(id)
+	if err != nil {
+		return err
+	}
+
+	err = app.comments.DeleteAll(id)
+	if err != nil {
+		return err
+	}
+
+	return app.collections.RemoveFromAll(id)
+}
+
+// The collectionError() helper sends the response for an error returned by a
+// change to a collection: 404 if there is no such collection, and 403 if it
+// belongs to another user
+func (app *application) collectionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		http.NotFound(w, r)
+	case errors.Is(err, models.ErrNotOwner):
+		app.clientError(w, http.StatusForbidden)
+	default:
+		app.serverError(w, r, err)
+	}
+}
+
+// The readableSnippet() helper returns the snippet if the current user may
+// read its content outside of the snippet page, and sends the matching error
+// response if not. The content of protected snippets can be read once they
+// have been unlocked, and burn after reading snippets only on the snippet page
+func (app *application) readableSnippet(w http.ResponseWriter, r *http.Request, id string) (models.Snippet, bool) {
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrBurned):
+			app.renderBurned(w, r)
+		case errors.Is(err, models.ErrNoRecord):
+			http.NotFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if !app.isUnlocked(r, snippet) || snippet.BurnAfterReading {
+		app.clientError(w, http.StatusForbidden)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// Snippets created before revisions were recorded have none. The
+// recordBaselineRevision() helper stores the current version of such a
+// snippet as its first revision, so that later changes can be compared to it
+func (app *application) recordBaselineRevision(snippet models.Snippet) error {
+	revisions, err := app.revisions.All(snippet.ID)
+	if err != nil || len(revisions) > 0 {
+		return err
+	}
+
+	_, err = app.revisions.Insert(snippet, snippet.UserID)
+	return err
+}
+
+// Return the revision with the given number from the list
+func findRevision(revisions []models.Revision, number int) (models.Revision, bool) {
+	for _, revision := range revisions {
+		if revision.Number == number {
+			return revision, true
+		}
+	}
+	return models.Revision{}, false
+}
+
+// Compare the files of two revisions and return the changed ones. The main
+// files are compared with each other, even if they were renamed, and the
+// other files by name. A file which only one of the revisions has is
+// compared with an empty one
+func diffRevisions(from, to models.Revision) []fileDiff {
+	fromFiles := snippetFiles(revisionSnippet(from))
+	toFiles := snippetFiles(revisionSnippet(to))
+
+	var diffs []fileDiff
+	add := func(name, old, new string) {
+		if hunks := diff.Unified(old, new, diffContextLines); len(hunks) > 0 {
+			diffs = append(diffs, fileDiff{Name: name, Hunks: hunks})
+		}
+	}
+
+	add(toFiles[0].Name, fromFiles[0].Content, toFiles[0].Content)
+
+	old := make(map[string]string)
+	for _, file := range fromFiles[1:] {
+		old[file.Name] = file.Content
+	}
+
+	for _, file := range toFiles[1:] {
+		add(file.Name, old[file.Name], file.Content)
+		delete(old, file.Name)
+	}
+
+	// The files which were removed
+	for _, file := range fromFiles[1:] {
+		if content, ok := old[file.Name]; ok {
+			add(file.Name, content, "")
+		}
+	}
+
+	return diffs
+}
+
+// Return a snippet with the content of the revision
+func revisionSnippet(revision models.Revision) models.Snippet {
+	return models.Snippet{
+		ID:       revision.SnippetID,
+		Title:    revision.Title,
+		Content:  revision.Content,
+		Language: revision.Language,
+		Filename: revision.Filename,
+		Files:    revision.Files,
+	}
+}
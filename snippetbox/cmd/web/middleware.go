@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
 
 	"github.com/justinas/nosurf"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func commonHeaders(next http.Handler) http.Handler {
@@ -77,7 +82,26 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
-// Uses a customized CSRF cookie with the Secure, Path and HttpOnly attributes set
+// Keeps the pages which manage the credentials of the user to the user who
+// logged in. A personal access token must not be able to create other tokens,
+// which would outlive its revocation, nor see or change the webhooks and
+// their secrets, so requests authenticated with one are forbidden
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated, ok := r.Context().Value(tokenAuthenticatedContextKey).(bool)
+		if ok && authenticated {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Uses a customized CSRF cookie with the Secure, Path and HttpOnly attributes set.
+// Requests authenticated with a personal access token (see authenticateToken)
+// are exempt: browsers never send the Authorization header on their own, so
+// another site can't forge them
 func noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
@@ -85,11 +109,22 @@ func noSurf(next http.Handler) http.Handler {
 		Path:     "/",
 		Secure:   true,
 	})
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		authenticated, ok := r.Context().Value(tokenAuthenticatedContextKey).(bool)
+		return ok && authenticated
+	})
 	return csrfHandler
 }
 
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A request authenticated with a token is made on behalf of the user
+		// of the token, whatever session cookie comes with it
+		if app.isAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Retrieve the authenticatedUserID value from the session using the
 		// GetInt() method. This will return the zero value for an int (0) if no
 		// "authenticatedUserID" value is in the session -- in which case we
@@ -110,9 +145,10 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// If a matching user is found, we know that the request is
 		// coming from an authenticated user who exists in our database. We
 		// create a new copy of the request (with an isAuthenticatedContextKey
-		// value of true in the request context) and assign it to r
+		// value of true and the user ID in the request context) and assign it to r
 		if exists {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
 			r = r.WithContext(ctx)
 		}
 
@@ -120,3 +156,149 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Add a new errReadOnlyToken error if a read-only personal access token is
+// used for a request which changes something
+var errReadOnlyToken = errors.New("read-only token")
+
+// Return the personal access token sent in the Authorization header of the
+// request, if the header uses the Bearer scheme
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// Authenticate the request with the personal access token. This returns a
+// copy of the request with the user of the token in the context, under the
+// same keys which authenticate() uses. Read-only tokens are only accepted for
+// GET, HEAD and OPTIONS requests
+func (app *application) withToken(r *http.Request, plaintext string) (*http.Request, error) {
+	token, err := app.tokens.Authenticate(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Scope != models.ScopeReadWrite {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			return nil, errReadOnlyToken
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+	ctx = context.WithValue(ctx, authenticatedUserIDContextKey, token.UserID)
+	ctx = context.WithValue(ctx, tokenAuthenticatedContextKey, true)
+
+	return r.WithContext(ctx), nil
+}
+
+// Authenticates requests which send a personal access token in an
+// "Authorization: Bearer" header, so that scripts can use the pages which
+// require authentication without a session. Requests without a token are left
+// to authenticate(). It runs before noSurf, which lets the requests it
+// authenticated through without a CSRF token
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		authenticated, err := app.withToken(r, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidCredentials):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="snippetbox"`)
+				app.clientError(w, http.StatusUnauthorized)
+			case errors.Is(err, errReadOnlyToken):
+				app.clientError(w, http.StatusForbidden)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, authenticated)
+	})
+}
+
+// Authenticates JSON API requests. API clients don't keep a session, so
+// they authenticate every request, either with a personal access token
+// ("Authorization: Bearer") or with the email and password of the user (HTTP
+// Basic authentication). Requests without credentials are anonymous
+func (app *application) apiAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			authenticated, err := app.withToken(r, token)
+			if err != nil {
+				switch {
+				case errors.Is(err, models.ErrInvalidCredentials):
+					w.Header().Set("WWW-Authenticate", `Bearer realm="snippetbox"`)
+					app.apiError(w, http.StatusUnauthorized, "invalid or revoked token")
+				case errors.Is(err, errReadOnlyToken):
+					app.apiError(w, http.StatusForbidden, "the token is read-only")
+				default:
+					app.apiServerError(w, r, err)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, authenticated)
+			return
+		}
+
+		email, password, ok := r.BasicAuth()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Unlike a missing session, wrong credentials are an error: the
+		// client meant to act as a user
+		id, err := app.users.Authenticate(email, password)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="snippetbox"`)
+				app.apiError(w, http.StatusUnauthorized, "invalid authentication credentials")
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+
+		userID, ok := id.(primitive.ObjectID)
+		if !ok {
+			app.apiServerError(w, r, errors.New("invalid user ID type"))
+			return
+		}
+
+		// Use the same context keys as authenticate(), so that the handlers
+		// can call isAuthenticated() and authenticatedUserID()
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserIDContextKey, userID.Hex())
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// The JSON API version of requireAuthentication(). Instead of redirecting to
+// the login page, it responds with 401 Unauthorized
+func (app *application) apiRequireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="snippetbox"`)
+			w.Header().Add("WWW-Authenticate", `Basic realm="snippetbox"`)
+			app.apiError(w, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
@@ -71,3 +72,173 @@ func TestCommonHeaders(t *testing.T) {
 
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestAuthenticateToken(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		urlPath  string
+		body     string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Page with read-only token",
+			method:   http.MethodGet,
+			urlPath:  "/account/snippets",
+			token:    "sbx_read",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Page with invalid token",
+			method:   http.MethodGet,
+			urlPath:  "/account/snippets",
+			token:    "sbx_revoked",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			// Requests with a token don't need a CSRF token
+			name:     "Form with read-write token",
+			method:   http.MethodPost,
+			urlPath:  "/snippet/delete/111111111111111111111111",
+			token:    "sbx_read-write",
+			wantCode: http.StatusSeeOther,
+		},
+		{
+			name:     "Form with read-only token",
+			method:   http.MethodPost,
+			urlPath:  "/snippet/delete/111111111111111111111111",
+			token:    "sbx_read",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Form with invalid token",
+			method:   http.MethodPost,
+			urlPath:  "/snippet/delete/111111111111111111111111",
+			token:    "sbx_revoked",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "API with read-only token",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/account/snippets",
+			token:    "sbx_read",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "API write with read-only token",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/snippets",
+			body:     `{"title": "O snail", "content": "Climb Mount Fuji"}`,
+			token:    "sbx_read",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "API write with read-write token",
+			method:   http.MethodPost,
+			urlPath:  "/api/v1/snippets",
+			body:     `{"title": "O snail", "content": "Climb Mount Fuji"}`,
+			token:    "sbx_read-write",
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "API with invalid token",
+			method:   http.MethodGet,
+			urlPath:  "/api/v1/account/snippets",
+			token:    "sbx_revoked",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Authorization": {"Bearer " + tt.token}}
+
+			code, _, _ := ts.request(t, tt.method, tt.urlPath, tt.body, header)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+// The pages which manage tokens and webhooks can't be used with a token, so
+// that a leaked token can't be used to keep access after it is revoked, nor
+// to read the secrets of the webhooks
+func TestRequireSession(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		method  string
+		urlPath string
+		token   string
+	}{
+		{
+			name:    "Tokens page",
+			method:  http.MethodGet,
+			urlPath: "/account/tokens",
+			token:   "sbx_read",
+		},
+		{
+			name:    "Create token",
+			method:  http.MethodPost,
+			urlPath: "/account/tokens/create",
+			token:   "sbx_read-write",
+		},
+		{
+			name:    "Revoke token",
+			method:  http.MethodPost,
+			urlPath: "/account/tokens/revoke/eeeeeeeeeeeeeeeeeeeeee01",
+			token:   "sbx_read-write",
+		},
+		{
+			name:    "Webhooks page",
+			method:  http.MethodGet,
+			urlPath: "/account/webhooks",
+			token:   "sbx_read",
+		},
+		{
+			name:    "Create webhook",
+			method:  http.MethodPost,
+			urlPath: "/account/webhooks/create",
+			token:   "sbx_read-write",
+		},
+		{
+			name:    "Delete webhook",
+			method:  http.MethodPost,
+			urlPath: "/account/webhooks/delete/ffffffffffffffffffffff01",
+			token:   "sbx_read-write",
+		},
+		{
+			name:    "Delivery log",
+			method:  http.MethodGet,
+			urlPath: "/account/webhooks/deliveries",
+			token:   "sbx_read",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Authorization": {"Bearer " + tt.token}}
+
+			code, _, body := ts.request(t, tt.method, tt.urlPath, "name=Leaked&url=https://example.com/hook", header)
+			assert.Equal(t, code, http.StatusForbidden)
+			assert.Equal(t, strings.Contains(body, "sbx_"), false)
+			assert.Equal(t, strings.Contains(body, "s3cret"), false)
+		})
+	}
+
+	// The user who logged in can use them
+	ts.login(t)
+
+	code, _, _ := ts.get(t, "/account/tokens")
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _, _ = ts.get(t, "/account/webhooks")
+	assert.Equal(t, code, http.StatusOK)
+}
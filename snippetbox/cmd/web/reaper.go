@@ -0,0 +1,40 @@
+package main
+
+import (
+	"time"
+)
+
+// The reapExpiredSnippets() method deletes the expired snippets every interval,
+// until the done channel is closed. It is meant to be run in a background
+// goroutine. With dryRun the expired snippets are only counted and logged
+func (app *application) reapExpiredSnippets(interval time.Duration, dryRun bool, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeExpiredSnippets(dryRun)
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Run one pass of the reaper and log the result. A failed pass is only
+// logged, the next one will try again
+func (app *application) purgeExpiredSnippets(dryRun bool) {
+	count, err := app.snippets.PurgeExpired(dryRun)
+	if err != nil {
+		app.logger.Error("purging expired snippets failed", "error", err.Error())
+		return
+	}
+
+	if dryRun {
+		app.logger.Info("found expired snippets", "count", count, "dry_run", true)
+		return
+	}
+
+	app.logger.Info("purged expired snippets", "count", count)
+}
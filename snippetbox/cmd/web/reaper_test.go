@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+)
+
+func TestPurgeExpiredSnippets(t *testing.T) {
+	tests := []struct {
+		name    string
+		dryRun  bool
+		wantLog string
+	}{
+		{
+			name:    "Purge",
+			dryRun:  false,
+			wantLog: `msg="purged expired snippets" count=2`,
+		},
+		{
+			name:    "Dry run",
+			dryRun:  true,
+			wantLog: `msg="found expired snippets" count=2 dry_run=true`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			app := newTestApplication(t)
+			app.logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+			app.purgeExpiredSnippets(tt.dryRun)
+
+			assert.StringContains(t, buf.String(), tt.wantLog)
+		})
+	}
+}
@@ -18,10 +18,28 @@ func (app *application) routes() http.Handler {
 	mux.HandleFunc("GET /ping", ping)
 
 	// Unprotected application routes using the "dynamic" middleware chain
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.authenticateToken, noSurf, app.authenticate)
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
+	mux.Handle("GET /snippets", dynamic.ThenFunc(app.snippetBrowse))
+	mux.Handle("GET /search", dynamic.ThenFunc(app.search))
+	mux.Handle("GET /tags/{tag}", dynamic.ThenFunc(app.tagView))
 	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("POST /snippet/unlock/{id}", dynamic.ThenFunc(app.snippetUnlockPost))
+	mux.Handle("GET /snippet/raw/{id}", dynamic.ThenFunc(app.snippetRaw))
+	mux.Handle("GET /snippet/download/{id}", dynamic.ThenFunc(app.snippetDownload))
+	mux.Handle("GET /snippet/zip/{id}", dynamic.ThenFunc(app.snippetZip))
+
+	// The pages which follow the ID of a snippet. "GET /snippet/{id}/history"
+	// can't be registered on its own: it would conflict with the
+	// /snippet/<action>/{id} routes, since neither would be more specific. A
+	// wildcard for the last segment is less specific than all of them
+	mux.Handle("GET /snippet/{id}/{action}", dynamic.Then(snippetActions(map[string]http.HandlerFunc{
+		"history": app.snippetHistory,
+		"diff":    app.snippetDiff,
+	})))
+
+	mux.Handle("GET /collections/{id}", dynamic.ThenFunc(app.collectionView))
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
 	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
@@ -32,11 +50,105 @@ func (app *application) routes() http.Handler {
 
 	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreate))
 	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	mux.Handle("GET /snippet/created/{id}", protected.ThenFunc(app.snippetCreated))
+	mux.Handle("GET /snippet/edit/{id}", protected.ThenFunc(app.snippetEdit))
+	mux.Handle("POST /snippet/edit/{id}", protected.ThenFunc(app.snippetEditPost))
+	mux.Handle("POST /snippet/fork/{id}", protected.ThenFunc(app.snippetForkPost))
+	// Starring follows the ID of the snippet, like its history (see above)
+	mux.Handle("POST /snippet/{id}/{action}", protected.Then(snippetActions(map[string]http.HandlerFunc{
+		"star":   app.snippetStarPost,
+		"unstar": app.snippetUnstarPost,
+	})))
+	mux.Handle("POST /snippet/comment/{id}", protected.ThenFunc(app.snippetCommentPost))
+	mux.Handle("POST /comment/delete/{id}", protected.ThenFunc(app.commentDeletePost))
+	mux.Handle("POST /snippet/revert/{id}", protected.ThenFunc(app.snippetRevertPost))
+	mux.Handle("POST /snippet/delete/{id}", protected.ThenFunc(app.snippetDeletePost))
+	mux.Handle("GET /account/snippets", protected.ThenFunc(app.accountSnippets))
+	mux.Handle("GET /account/starred", protected.ThenFunc(app.accountStarred))
+	mux.Handle("GET /collections", protected.ThenFunc(app.collectionList))
+	mux.Handle("GET /collections/create", protected.ThenFunc(app.collectionCreate))
+	mux.Handle("POST /collections/create", protected.ThenFunc(app.collectionCreatePost))
+	mux.Handle("GET /collections/{id}/edit", protected.ThenFunc(app.collectionEdit))
+	mux.Handle("POST /collections/{id}/edit", protected.ThenFunc(app.collectionEditPost))
+	mux.Handle("POST /collections/{id}/delete", protected.ThenFunc(app.collectionDeletePost))
+	mux.Handle("POST /collections/{id}/add", protected.ThenFunc(app.collectionAddPost))
+	mux.Handle("POST /collections/{id}/remove", protected.ThenFunc(app.collectionRemovePost))
+	mux.Handle("POST /collections/{id}/move", protected.ThenFunc(app.collectionMovePost))
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
 
+	// The pages which manage tokens and webhooks can't be used with a token,
+	// only by the user who logged in, which includes the requireSession middleware
+	session := protected.Append(app.requireSession)
+
+	mux.Handle("GET /account/tokens", session.ThenFunc(app.accountTokens))
+	mux.Handle("POST /account/tokens/create", session.ThenFunc(app.accountTokenCreatePost))
+	mux.Handle("POST /account/tokens/revoke/{id}", session.ThenFunc(app.accountTokenRevokePost))
+	mux.Handle("GET /account/webhooks", session.ThenFunc(app.accountWebhooks))
+	mux.Handle("POST /account/webhooks/create", session.ThenFunc(app.accountWebhookCreatePost))
+	mux.Handle("POST /account/webhooks/delete/{id}", session.ThenFunc(app.accountWebhookDeletePost))
+	mux.Handle("GET /account/webhooks/deliveries", session.ThenFunc(app.accountWebhookDeliveries))
+
+	// The OpenAPI document of the JSON API. The docs page which renders it
+	// is a static file (/static/api/)
+	mux.HandleFunc("GET /api/openapi.json", app.apiSpec)
+
+	// JSON API routes. They don't use sessions or CSRF tokens: clients
+	// authenticate every request instead, with a personal access token or
+	// with their email and password
+	api := alice.New(app.apiAuthenticate)
+	apiProtected := api.Append(app.apiRequireAuthentication)
+
+	mux.Handle("/api/v1/", api.ThenFunc(app.apiNotFound))
+
+	for _, route := range app.apiRoutes() {
+		chain := api
+		if route.protected {
+			chain = apiProtected
+		}
+		mux.Handle(route.method+" "+route.path, chain.ThenFunc(route.handler))
+	}
+
 	// Create a middleware chain which will be used for every request application receives
 	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders)
 
 	// Return the 'standard' middleware chain followed by the servemux
 	return standard.Then(mux)
 }
+
+// Define an apiRoute type to hold a route of the JSON API. Protected routes
+// require an authenticated user
+type apiRoute struct {
+	method    string
+	path      string
+	handler   http.HandlerFunc
+	protected bool
+}
+
+// The apiRoutes() method returns the routes of the JSON API. They are kept in
+// a table, so that the tests can check the OpenAPI document (ui/openapi.json)
+// against them
+func (app *application) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{method: http.MethodGet, path: "/api/v1/snippets", handler: app.apiSnippetList},
+		{method: http.MethodGet, path: "/api/v1/snippets/{id}", handler: app.apiSnippetGet},
+		{method: http.MethodPost, path: "/api/v1/snippets", handler: app.apiSnippetCreate, protected: true},
+		{method: http.MethodPut, path: "/api/v1/snippets/{id}", handler: app.apiSnippetUpdate, protected: true},
+		{method: http.MethodDelete, path: "/api/v1/snippets/{id}", handler: app.apiSnippetDelete, protected: true},
+		{method: http.MethodGet, path: "/api/v1/account/snippets", handler: app.apiAccountSnippets, protected: true},
+	}
+}
+
+// The snippetActions() helper returns a handler which passes the request to
+// the handler of the {action} wildcard, or replies with a 404 Not Found if
+// there is no such action
+func snippetActions(handlers map[string]http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.PathValue("action")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		handler(w, r)
+	})
+}
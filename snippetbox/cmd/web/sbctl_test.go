@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/sbclient"
+)
+
+// Run sbctl with the arguments and the standard input, and return its exit
+// status, standard output and standard error
+func runSbctl(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	status := sbclient.Run(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	return status, stdout.String(), stderr.String()
+}
+
+// End-to-end tests of the sbctl commands against the application over HTTPS.
+// The self-signed certificate of the test server is passed with -ca, like
+// ./tls/cert.pem is for a real server
+func TestSbctl(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	dir := t.TempDir()
+
+	caPath := filepath.Join(dir, "cert.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	err := os.WriteFile(caPath, ca, 0o600)
+	assert.NilError(t, err)
+
+	configPath := filepath.Join(dir, "config.json")
+
+	// Without the certificate, the server can't be trusted
+	status, _, stderr := runSbctl(t, "", "login", "-config", configPath, "-server", ts.URL, "-token", "sbx_read-write")
+	assert.Equal(t, status, 1)
+	assert.StringContains(t, stderr, "certificate")
+
+	status, _, stderr = runSbctl(t, "", "login", "-config", configPath, "-server", ts.URL, "-token", "sbx_revoked", "-ca", caPath)
+	assert.Equal(t, status, 1)
+	assert.StringContains(t, stderr, "invalid or revoked token (401)")
+
+	// The other commands use the stored settings
+	status, stdout, _ := runSbctl(t, "", "login", "-config", configPath, "-server", ts.URL, "-token", "sbx_read-write", "-ca", caPath)
+	assert.Equal(t, status, 0)
+	assert.StringContains(t, stdout, "Logged in to "+ts.URL)
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "Create",
+			args:       []string{"create", "-title", "O snail", "-expires", "1d", "-visibility", "unlisted", "-tags", "haiku, fuji"},
+			stdin:      "Climb Mount Fuji,\nBut slowly, slowly!\n",
+			wantStatus: 0,
+			wantStdout: ts.URL + "/snippet/view/222222222222222222222222\n",
+		},
+		{
+			name:       "Create without title",
+			args:       []string{"create"},
+			stdin:      "Climb Mount Fuji",
+			wantStatus: 1,
+			wantStderr: "title: This field cannot be blank",
+		},
+		{
+			name:       "Create with invalid expiry",
+			args:       []string{"create", "-title", "O snail", "-expires", "2y"},
+			stdin:      "Climb Mount Fuji",
+			wantStatus: 1,
+			wantStderr: "expires: This field must be one of the listed expiry options",
+		},
+		{
+			name:       "Raw",
+			args:       []string{"raw", "111111111111111111111111"},
+			wantStatus: 0,
+			wantStdout: "An old silent pond...",
+		},
+		{
+			name:       "Raw protected snippet",
+			args:       []string{"raw", "-passphrase", "open sesame", "555555555555555555555555"},
+			wantStatus: 0,
+			wantStdout: "Lightning flash...",
+		},
+		{
+			name:       "Raw non-existent snippet",
+			args:       []string{"raw", "222222222222222222222222"},
+			wantStatus: 1,
+			wantStderr: "the snippet could not be found (404)",
+		},
+		{
+			name:       "List",
+			args:       []string{"list"},
+			wantStatus: 0,
+			wantStdout: "111111111111111111111111  An old silent pond",
+		},
+		{
+			name:       "Delete",
+			args:       []string{"delete", "111111111111111111111111"},
+			wantStatus: 0,
+			wantStdout: "Deleted 111111111111111111111111\n",
+		},
+		{
+			name:       "Delete foreign snippet",
+			args:       []string{"delete", "333333333333333333333333"},
+			wantStatus: 1,
+			wantStderr: "333333333333333333333333: the snippet belongs to another user (403)",
+		},
+		{
+			name:       "Delete without ID",
+			args:       []string{"delete"},
+			wantStatus: 2,
+			wantStderr: "wrong number of arguments",
+		},
+		{
+			name:       "Read-only token",
+			args:       []string{"delete", "-token", "sbx_read", "111111111111111111111111"},
+			wantStatus: 1,
+			wantStderr: "the token is read-only (403)",
+		},
+		{
+			name:       "Unknown command",
+			args:       []string{"edit"},
+			wantStatus: 2,
+			wantStderr: `unknown command "edit"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Pass the configuration file after the command
+			args := append([]string{tt.args[0], "-config", configPath}, tt.args[1:]...)
+
+			status, stdout, stderr := runSbctl(t, tt.stdin, args...)
+			assert.Equal(t, status, tt.wantStatus)
+			assert.StringContains(t, stdout, tt.wantStdout)
+			assert.StringContains(t, stderr, tt.wantStderr)
+		})
+	}
+}
@@ -3,9 +3,20 @@ package main
 import (
 	"html/template"
 	"io/fs"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/diff"
+	// Imported as syntax, since highlight() marks the terms of a search
+	syntax "github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/highlight"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/markdown"
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/ui"
 )
@@ -13,13 +24,179 @@ import (
 // Define a templateData type to act as the holding structure for
 // any dynamic data that we want to pass to our HTML templates
 type templateData struct {
-	CurrentYear     int
-	Snippet         models.Snippet
-	Snippets        []models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string
+	CurrentYear         int
+	Snippet             models.Snippet
+	Snippets            []models.Snippet
+	Form                any
+	Flash               string
+	IsAuthenticated     bool
+	CSRFToken           string
+	AuthenticatedUserID string
+	Pagination          *pagination
+	FirstURL            string
+	NextURL             string
+	Link                string
+	Revisions           []models.Revision
+	Diff                *revisionDiff
+	Tag                 string
+	TagCloud            []tagCloudEntry
+	IsStarred           bool
+	MostStarred         []models.Snippet
+	Comments            []commentThread
+	Collection          models.Collection
+	Collections         []models.Collection
+	Tokens              []models.Token
+	NewToken            string
+	Webhooks            []models.Webhook
+	Deliveries          []models.Delivery
+}
+
+// Returns true if the current user may delete the comment: its author and
+// the owner of the snippet may
+func (d templateData) CanDeleteComment(comment models.Comment) bool {
+	return d.AuthenticatedUserID != "" && (comment.UserID == d.AuthenticatedUserID || d.Snippet.UserID == d.AuthenticatedUserID)
+}
+
+// Define a commentThread type to hold a comment on a snippet together with
+// the replies to it
+type commentThread struct {
+	models.Comment
+	Replies []models.Comment
+}
+
+// Create a newCommentThreads() helper, which groups the replies with the
+// comments they reply to. The order of the comments and of the replies is
+// kept. Replies to comments which aren't there are left out
+func newCommentThreads(comments []models.Comment) []commentThread {
+	var threads []commentThread
+	index := make(map[string]int)
+
+	for _, comment := range comments {
+		if comment.ParentID == "" {
+			index[comment.ID] = len(threads)
+			threads = append(threads, commentThread{Comment: comment})
+		}
+	}
+
+	for _, comment := range comments {
+		if i, ok := index[comment.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, comment)
+		}
+	}
+
+	return threads
+}
+
+// Define a tagCloudEntry type to hold one tag of the tag cloud. Size is from
+// 1 to tagCloudSizes and grows with the number of snippets with the tag
+type tagCloudEntry struct {
+	Tag   string
+	Count int
+	Size  int
+}
+
+// The number of font sizes used by the tag cloud
+const tagCloudSizes = 5
+
+// Create a newTagCloud() helper, which spreads the counts of the tags evenly
+// over the font sizes of the tag cloud, from the least to the most used tag
+func newTagCloud(tags []models.TagCount) []tagCloudEntry {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	least, most := tags[0].Count, tags[0].Count
+	for _, tag := range tags {
+		least = min(least, tag.Count)
+		most = max(most, tag.Count)
+	}
+
+	cloud := make([]tagCloudEntry, len(tags))
+	for i, tag := range tags {
+		size := 1
+		if most > least {
+			size += (tag.Count - least) * (tagCloudSizes - 1) / (most - least)
+		}
+		cloud[i] = tagCloudEntry{Tag: tag.Tag, Count: tag.Count, Size: size}
+	}
+
+	return cloud
+}
+
+// Define a revisionDiff type to hold two revisions of a snippet and the
+// changes between their files
+type revisionDiff struct {
+	From  models.Revision
+	To    models.Revision
+	Files []fileDiff
+}
+
+// Define a fileDiff type to hold the changes of one file of a snippet
+type fileDiff struct {
+	Name  string
+	Hunks []diff.Hunk
+}
+
+// Define a pagination type to hold the data needed for rendering the page
+// links of a paginated list
+type pagination struct {
+	Page     int
+	PageSize int
+	Total    int
+	path     string
+	query    url.Values
+}
+
+// Create a newPagination() helper, which returns the pagination for the given
+// page of a list with total items. The links keep all the other query string
+// parameters of the current request
+func newPagination(r *http.Request, page, pageSize, total int) *pagination {
+	return &pagination{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		path:     r.URL.Path,
+		query:    r.URL.Query(),
+	}
+}
+
+// Returns the number of pages needed to show all the items
+func (p *pagination) TotalPages() int {
+	if p.Total == 0 || p.PageSize <= 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+// Returns true if there are pages before the current one
+func (p *pagination) HasPrevious() bool {
+	return p.Page > 1
+}
+
+// Returns true if there are pages after the current one
+func (p *pagination) HasNext() bool {
+	return p.Page < p.TotalPages()
+}
+
+// Returns the URL of the previous page
+func (p *pagination) PreviousURL() string {
+	return p.URL(p.Page - 1)
+}
+
+// Returns the URL of the next page
+func (p *pagination) NextURL() string {
+	return p.URL(p.Page + 1)
+}
+
+// Returns the URL of the given page
+func (p *pagination) URL(page int) string {
+	query := url.Values{}
+	for key, values := range p.query {
+		query[key] = values
+	}
+	query.Set("page", strconv.Itoa(page))
+
+	return p.path + "?" + query.Encode()
 }
 
 // Returns a nicely formatted string representation of a time.Time object
@@ -36,6 +213,96 @@ func humanDate(t time.Time) string {
 // custom template functions and the functions themselves
 var functions = template.FuncMap{
 	"humanDate": humanDate,
+	"excerpt":   excerpt,
+	"highlight": highlight,
+	"code":      syntax.HTML,
+	"numbered":  syntax.NumberedHTML,
+	"languages": func() []syntax.Language { return syntax.Languages },
+	"language":  syntax.Label,
+	"markdown":  markdown.HTML,
+	"files":     snippetFiles,
+	"add":       func(a, b int) int { return a + b },
+	"contains":  slices.Contains[[]string],
+}
+
+// Split a search query into the words which should be highlighted in the
+// results. Quotes are dropped, and negated words (like -foo) are skipped
+func searchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		terms = append(terms, field)
+	}
+	return terms
+}
+
+// Returns a regular expression which matches any of the search terms ignoring
+// case, or nil if there are no terms
+func searchTermsRegexp(query string) *regexp.Regexp {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	for i, term := range terms {
+		terms[i] = regexp.QuoteMeta(term)
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// The number of characters of context shown around a search match
+const excerptLength = 200
+
+// Returns a part of the text around the first match of the search query, so
+// long snippets can be shown in the search results
+func excerpt(text, query string) string {
+	runes := []rune(text)
+	if len(runes) <= excerptLength {
+		return text
+	}
+
+	// Start a bit before the first match, if there is one
+	start := 0
+	if rx := searchTermsRegexp(query); rx != nil {
+		if loc := rx.FindStringIndex(text); loc != nil {
+			start = max(utf8.RuneCountInString(text[:loc[0]])-excerptLength/4, 0)
+		}
+	}
+	end := min(start+excerptLength, len(runes))
+
+	result := string(runes[start:end])
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(runes) {
+		result += "…"
+	}
+	return result
+}
+
+// Returns the HTML escaped text with all the words of the search query
+// wrapped in <mark> elements
+func highlight(text, query string) template.HTML {
+	rx := searchTermsRegexp(query)
+	if rx == nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range rx.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:loc[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[loc[0]:loc[1]]))
+		b.WriteString("</mark>")
+		last = loc[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+
+	return template.HTML(b.String())
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
 )
 
 func TestHumanDate(t *testing.T) {
@@ -48,3 +50,102 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestPagination(t *testing.T) {
+	r := httptest.NewRequest("GET", "/account/snippets?sort=title&page=2", nil)
+	p := newPagination(r, 2, 20, 41)
+
+	assert.Equal(t, p.TotalPages(), 3)
+	assert.Equal(t, p.HasPrevious(), true)
+	assert.Equal(t, p.HasNext(), true)
+	assert.Equal(t, p.PreviousURL(), "/account/snippets?page=1&sort=title")
+	assert.Equal(t, p.NextURL(), "/account/snippets?page=3&sort=title")
+
+	// A list without any items still has a single page
+	p = newPagination(r, 1, 20, 0)
+
+	assert.Equal(t, p.TotalPages(), 1)
+	assert.Equal(t, p.HasPrevious(), false)
+	assert.Equal(t, p.HasNext(), false)
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{
+			name:  "Single word",
+			text:  "An old silent pond",
+			query: "pond",
+			want:  "An old silent <mark>pond</mark>",
+		},
+		{
+			name:  "Several words ignoring case",
+			text:  "An old silent Pond",
+			query: `"old" pond`,
+			want:  "An <mark>old</mark> silent <mark>Pond</mark>",
+		},
+		{
+			name:  "Negated word",
+			text:  "An old silent pond",
+			query: "pond -old",
+			want:  "An old silent <mark>pond</mark>",
+		},
+		{
+			name:  "Escaped HTML",
+			text:  "<b>pond</b>",
+			query: "pond",
+			want:  "&lt;b&gt;<mark>pond</mark>&lt;/b&gt;",
+		},
+		{
+			name:  "Empty query",
+			text:  "An old silent pond",
+			query: "",
+			want:  "An old silent pond",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, string(highlight(tt.text, tt.query)), tt.want)
+		})
+	}
+}
+
+func TestNewTagCloud(t *testing.T) {
+	cloud := newTagCloud([]models.TagCount{
+		{Tag: "go", Count: 9},
+		{Tag: "http", Count: 5},
+		{Tag: "sql", Count: 1},
+	})
+
+	assert.Equal(t, len(cloud), 3)
+	assert.Equal(t, cloud[0].Size, 5)
+	assert.Equal(t, cloud[1].Size, 3)
+	assert.Equal(t, cloud[2].Size, 1)
+
+	// Tags used equally often all get the smallest size
+	cloud = newTagCloud([]models.TagCount{{Tag: "go", Count: 2}, {Tag: "sql", Count: 2}})
+	assert.Equal(t, cloud[0].Size, 1)
+	assert.Equal(t, cloud[1].Size, 1)
+}
+
+func TestNewCommentThreads(t *testing.T) {
+	threads := newCommentThreads([]models.Comment{
+		{ID: "1", Body: "First"},
+		{ID: "2", Body: "Reply to first", ParentID: "1"},
+		{ID: "3", Body: "Second"},
+		{ID: "4", Body: "Another reply to first", ParentID: "1"},
+		{ID: "5", Body: "Reply to a deleted comment", ParentID: "9"},
+	})
+
+	assert.Equal(t, len(threads), 2)
+	assert.Equal(t, threads[0].Body, "First")
+	assert.Equal(t, len(threads[0].Replies), 2)
+	assert.Equal(t, threads[0].Replies[1].Body, "Another reply to first")
+	assert.Equal(t, threads[1].Body, "Second")
+	assert.Equal(t, len(threads[1].Replies), 0)
+}
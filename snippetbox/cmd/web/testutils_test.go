@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -52,8 +53,15 @@ func newTestApplication(t *testing.T) *application {
 
 	return &application{
 		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
-		snippets:       &mocks.SnippetModel{}, // Use the mock.
-		users:          &mocks.UserModel{},    // Use the mock.
+		snippets:       &mocks.SnippetModel{},    // Use the mock.
+		users:          &mocks.UserModel{},       // Use the mock.
+		revisions:      &mocks.RevisionModel{},   // Use the mock.
+		stars:          &mocks.StarModel{},       // Use the mock.
+		comments:       &mocks.CommentModel{},    // Use the mock.
+		collections:    &mocks.CollectionModel{}, // Use the mock.
+		tokens:         &mocks.TokenModel{},      // Use the mock.
+		webhooks:       &mocks.WebhookModel{},    // Use the mock.
+		webhookClient:  newWebhookClient(true),
 		templateCache:  templateCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
@@ -134,3 +142,48 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers and body
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Log in as the mocked user with ID 111111111111111111111111. The session
+// cookie is stored in the cookie jar of the test server client, so all the
+// following requests are made by an authenticated user
+func (ts *testServer) login(t *testing.T) {
+	_, _, body := ts.get(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", extractCSRFToken(t, body))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
+
+// Send a request with the method, body and headers to the test server. This
+// is used for the JSON API, which needs more than GET and form POST requests
+func (ts *testServer) request(t *testing.T, method string, urlPath string, body string, header http.Header) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	rsBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsBody = bytes.TrimSpace(rsBody)
+
+	return rs.StatusCode, rs.Header, string(rsBody)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/validator"
+)
+
+// Webhooks notify users of the events of their snippets. The events are
+// queued in the database (see models.WebhookModel) as the snippets change,
+// and sent by deliverWebhooks() in the background. The expiry of a snippet is
+// queued in advance, to be sent when the snippet expires
+
+const (
+	// A delivery is attempted this many times before it fails for good
+	webhookMaxAttempts = 8
+	// The delay before the first retry. It doubles with every retry, so the
+	// last one is about an hour after the first attempt
+	webhookRetryDelay = 30 * time.Second
+	// How long a claimed delivery is reserved for the worker sending it
+	webhookLease = time.Minute
+	// The maximum number of deliveries sent in one pass of the worker
+	webhookBatchSize = 100
+)
+
+// The headers of the webhook requests. The signature is the HMAC-SHA256 of
+// the body, keyed with the secret of the webhook
+const (
+	webhookEventHeader     = "X-Snippetbox-Event"
+	webhookDeliveryHeader  = "X-Snippetbox-Delivery"
+	webhookSignatureHeader = "X-Snippetbox-Signature-256"
+)
+
+// Define a webhookPayload type to hold the JSON body sent to webhooks. The
+// snippet is described like in the JSON API lists, without its content
+type webhookPayload struct {
+	Event   string     `json:"event"`
+	Created time.Time  `json:"created"`
+	URL     string     `json:"url"`
+	Snippet apiSnippet `json:"snippet"`
+}
+
+// Returned when a webhook request would be sent to an address which isn't
+// public
+var errWebhookAddress = errors.New("the webhook address isn't on the public internet")
+
+// Create the HTTP client which sends the webhook requests. Redirects aren't
+// followed: a webhook which answers with one must be fixed by its owner.
+// Users choose the URLs of their webhooks, so unless allowPrivate is true
+// (for the tests, which use local servers), the client only connects to public
+// addresses. They are checked as the connection is made, after the name
+// is resolved, so that a name can't lead to the internal network of the
+// server, even if it resolves to another address later
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !validator.PublicIP(addrPort.Addr()) {
+				return errWebhookAddress
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		// No proxy, which would make the connections instead of the dialer
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Return the signature of the payload, as sent in the signature header
+func signWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// The notifySnippet() helper queues the event of the snippet for the
+// webhooks of its owner. A snippet which is created or updated also gets its
+// expiry (re)scheduled. Webhooks are a side effect, so an event which can't
+// be queued is logged instead of failing the request
+func (app *application) notifySnippet(r *http.Request, event string, snippet models.Snippet) {
+	err := app.queueSnippetEvent(r, event, snippet)
+	if err != nil {
+		app.logger.Error("queueing webhook event failed", "event", event, "snippet", snippet.ID, "error", err.Error())
+	}
+}
+
+func (app *application) queueSnippetEvent(r *http.Request, event string, snippet models.Snippet) error {
+	// Whatever happened, the expiry which was scheduled is out of date
+	err := app.webhooks.CancelPending(snippet.ID, models.EventSnippetExpired)
+	if err != nil {
+		return err
+	}
+
+	err = app.enqueueSnippetEvent(r, event, snippet, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if (event == models.EventSnippetCreated || event == models.EventSnippetUpdated) && !snippet.Expires.IsZero() {
+		return app.enqueueSnippetEvent(r, models.EventSnippetExpired, snippet, snippet.Expires)
+	}
+
+	return nil
+}
+
+// Queue the event of the snippet, to be sent when due
+func (app *application) enqueueSnippetEvent(r *http.Request, event string, snippet models.Snippet, due time.Time) error {
+	// New snippets haven't been read back from the database
+	if snippet.Created.IsZero() {
+		snippet.Created = time.Now()
+	}
+
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		Event:   event,
+		Created: due,
+		URL:     fmt.Sprintf("%s://%s/snippet/view/%s", scheme, r.Host, snippet.ID),
+		Snippet: newAPISnippet(snippet, false),
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.webhooks.Enqueue(snippet.UserID, event, snippet.ID, payload, due)
+}
+
+// The deliverWebhooks() method sends the due webhook deliveries every
+// interval, until the done channel is closed. It is meant to be run in a
+// background goroutine, like reapExpiredSnippets()
+func (app *application) deliverWebhooks(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.deliverDueWebhooks()
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Send the deliveries which are due, up to webhookBatchSize of them
+func (app *application) deliverDueWebhooks() {
+	for range webhookBatchSize {
+		delivery, err := app.webhooks.Claim(webhookLease)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.logger.Error("claiming webhook delivery failed", "error", err.Error())
+			}
+			return
+		}
+
+		app.deliverWebhook(delivery)
+	}
+}
+
+// Send the delivery to its webhook and store the result. A delivery which
+// can't be stored is retried once its lease is over
+func (app *application) deliverWebhook(delivery models.Delivery) {
+	if delivery.Event == models.EventSnippetExpired {
+		var expired bool
+		var err error
+
+		delivery, expired, err = app.checkExpired(delivery)
+		if err != nil {
+			app.logger.Error("checking expired snippet failed", "delivery", delivery.ID, "error", err.Error())
+			return
+		}
+
+		if !expired {
+			err = app.webhooks.UpdateDelivery(delivery)
+			if err != nil {
+				app.logger.Error("updating webhook delivery failed", "delivery", delivery.ID, "error", err.Error())
+			}
+			return
+		}
+	}
+
+	webhook, err := app.webhooks.Get(delivery.WebhookID)
+	switch {
+	case errors.Is(err, models.ErrNoRecord):
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "the webhook has been deleted"
+	case err != nil:
+		app.logger.Error("loading webhook failed", "delivery", delivery.ID, "error", err.Error())
+		return
+	default:
+		delivery = app.sendWebhook(delivery, webhook)
+	}
+
+	err = app.webhooks.UpdateDelivery(delivery)
+	if err != nil {
+		app.logger.Error("updating webhook delivery failed", "delivery", delivery.ID, "error", err.Error())
+	}
+}
+
+// The expiry of a snippet is queued in advance, but the snippet is deleted
+// by the TTL index or the reaper, independently of the queue. Its expiry time
+// can also change without the application knowing, like in the database
+// shell. So the checkExpired() helper returns true only if the snippet is
+// really gone or expired. Otherwise the delivery is rescheduled for the
+// current expiry time of the snippet, or cancelled if it no longer expires
+func (app *application) checkExpired(delivery models.Delivery) (models.Delivery, bool, error) {
+	snippet, err := app.snippets.Get(delivery.SnippetID, delivery.UserID)
+	switch {
+	case errors.Is(err, models.ErrNoRecord), errors.Is(err, models.ErrBurned):
+		return delivery, true, nil
+	case err != nil:
+		return delivery, false, err
+	case snippet.Expires.IsZero():
+		delivery.Status = models.DeliveryCancelled
+		delivery.Error = "the snippet no longer expires"
+		return delivery, false, nil
+	}
+
+	// Tell the receiver about the current expiry time when it is due
+	var payload webhookPayload
+	err = json.Unmarshal(delivery.Payload, &payload)
+	if err != nil {
+		return delivery, false, err
+	}
+
+	payload.Created = snippet.Expires
+	payload.Snippet.Expires = &snippet.Expires
+
+	delivery.Payload, err = json.Marshal(payload)
+	if err != nil {
+		return delivery, false, err
+	}
+
+	delivery.NextAttempt = snippet.Expires
+	return delivery, false, nil
+}
+
+// Make one attempt to send the delivery to the webhook, and return the
+// delivery with its result. Failed attempts are retried with exponential
+// backoff, until webhookMaxAttempts
+func (app *application) sendWebhook(delivery models.Delivery, webhook models.Webhook) models.Delivery {
+	delivery.Attempts++
+
+	delivery.StatusCode, delivery.Error = 0, ""
+	statusCode, err := app.postWebhook(delivery, webhook)
+	delivery.StatusCode = statusCode
+
+	// The delivery log doesn't tell which address was refused, so that it
+	// can't be used to map the internal network
+	if errors.Is(err, errWebhookAddress) {
+		err = errWebhookAddress
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+	case delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		delivery.Status = models.DeliveryPending
+		delivery.Error = err.Error()
+		delivery.NextAttempt = time.Now().Add(webhookRetryDelay << (delivery.Attempts - 1))
+	}
+
+	return delivery
+}
+
+// Post the payload of the delivery to the webhook, and return the status code
+// of the response. Responses other than 2xx are errors
+func (app *application) postWebhook(delivery models.Delivery, webhook models.Webhook) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhook")
+	req.Header.Set(webhookEventHeader, delivery.Event)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+	req.Header.Set(webhookSignatureHeader, signWebhook(webhook.Secret, delivery.Payload))
+
+	rs, err := app.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Body.Close()
+
+	// Read a little of the body, so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(rs.Body, 4096))
+
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		return rs.StatusCode, fmt.Errorf("unexpected status %s", rs.Status)
+	}
+
+	return rs.StatusCode, nil
+}
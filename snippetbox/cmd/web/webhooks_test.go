@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models/mocks"
+)
+
+// Check which events the changes of snippets queue for the webhooks
+func TestSnippetEvents(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		urlPath       string
+		body          string
+		wantEvents    []string
+		wantSnippetID string
+	}{
+		{
+			name:          "Create",
+			method:        http.MethodPost,
+			urlPath:       "/api/v1/snippets",
+			body:          `{"title": "O snail", "content": "Climb Mount Fuji", "expires": "1d"}`,
+			wantEvents:    []string{models.EventSnippetCreated, models.EventSnippetExpired},
+			wantSnippetID: "222222222222222222222222",
+		},
+		{
+			name:          "Create without expiry",
+			method:        http.MethodPost,
+			urlPath:       "/api/v1/snippets",
+			body:          `{"title": "O snail", "content": "Climb Mount Fuji", "expires": "never"}`,
+			wantEvents:    []string{models.EventSnippetCreated},
+			wantSnippetID: "222222222222222222222222",
+		},
+		{
+			name:          "Update",
+			method:        http.MethodPut,
+			urlPath:       "/api/v1/snippets/111111111111111111111111",
+			body:          `{"title": "A new silent pond", "content": "An old silent pond...", "expires": "7d"}`,
+			wantEvents:    []string{models.EventSnippetUpdated, models.EventSnippetExpired},
+			wantSnippetID: "111111111111111111111111",
+		},
+		{
+			name:          "Delete",
+			method:        http.MethodDelete,
+			urlPath:       "/api/v1/snippets/111111111111111111111111",
+			wantEvents:    []string{models.EventSnippetDeleted},
+			wantSnippetID: "111111111111111111111111",
+		},
+		{
+			name:          "Burn",
+			method:        http.MethodGet,
+			urlPath:       "/api/v1/snippets/666666666666666666666666",
+			wantEvents:    []string{models.EventSnippetExpired},
+			wantSnippetID: "666666666666666666666666",
+		},
+		{
+			name:       "Delete foreign snippet",
+			method:     http.MethodDelete,
+			urlPath:    "/api/v1/snippets/333333333333333333333333",
+			wantEvents: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			ts.request(t, tt.method, tt.urlPath, tt.body, aliceHeader)
+
+			enqueued := app.webhooks.(*mocks.WebhookModel).Enqueued()
+			assert.Equal(t, len(enqueued), len(tt.wantEvents))
+
+			for i, delivery := range enqueued {
+				assert.Equal(t, delivery.Event, tt.wantEvents[i])
+				assert.Equal(t, delivery.SnippetID, tt.wantSnippetID)
+				assert.Equal(t, delivery.UserID, "111111111111111111111111")
+
+				var payload webhookPayload
+				err := json.Unmarshal(delivery.Payload, &payload)
+				assert.NilError(t, err)
+				assert.Equal(t, payload.Event, delivery.Event)
+				assert.Equal(t, payload.Snippet.ID, tt.wantSnippetID)
+				assert.Equal(t, payload.URL, ts.URL+"/snippet/view/"+tt.wantSnippetID)
+
+				// The expiry is sent when the snippet expires
+				if delivery.Event == models.EventSnippetExpired && tt.method != http.MethodGet {
+					assert.Equal(t, delivery.NextAttempt.Equal(*payload.Snippet.Expires), true)
+				} else {
+					assert.Equal(t, delivery.NextAttempt.After(time.Now()), false)
+				}
+			}
+		})
+	}
+}
+
+// Send deliveries to an httptest.Server acting as the receiver of the webhook,
+// which checks the request and answers with the status of the test
+func TestSendWebhook(t *testing.T) {
+	payload := []byte(`{"event":"snippet.created"}`)
+
+	tests := []struct {
+		name           string
+		status         int
+		attempts       int
+		wantStatus     string
+		wantStatusCode int
+		wantError      string
+		wantRetry      time.Duration
+	}{
+		{
+			name:           "Delivered",
+			status:         http.StatusNoContent,
+			attempts:       0,
+			wantStatus:     models.DeliveryDelivered,
+			wantStatusCode: http.StatusNoContent,
+		},
+		{
+			name:           "First failure",
+			status:         http.StatusInternalServerError,
+			attempts:       0,
+			wantStatus:     models.DeliveryPending,
+			wantStatusCode: http.StatusInternalServerError,
+			wantError:      "unexpected status 500 Internal Server Error",
+			wantRetry:      webhookRetryDelay,
+		},
+		{
+			name:           "Third failure",
+			status:         http.StatusBadGateway,
+			attempts:       2,
+			wantStatus:     models.DeliveryPending,
+			wantStatusCode: http.StatusBadGateway,
+			wantError:      "unexpected status 502 Bad Gateway",
+			wantRetry:      4 * webhookRetryDelay,
+		},
+		{
+			name:           "Last failure",
+			status:         http.StatusInternalServerError,
+			attempts:       webhookMaxAttempts - 1,
+			wantStatus:     models.DeliveryFailed,
+			wantStatusCode: http.StatusInternalServerError,
+			wantError:      "unexpected status 500 Internal Server Error",
+		},
+		{
+			name:           "Redirect",
+			status:         http.StatusFound,
+			attempts:       0,
+			wantStatus:     models.DeliveryPending,
+			wantStatusCode: http.StatusFound,
+			wantError:      "unexpected status 302 Found",
+			wantRetry:      webhookRetryDelay,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received *http.Request
+			var body []byte
+
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				body, _ = io.ReadAll(r.Body)
+
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			app := newTestApplication(t)
+
+			webhook := models.Webhook{ID: "ffffffffffffffffffffff01", URL: receiver.URL, Secret: "s3cret"}
+			delivery := models.Delivery{
+				ID:        "ffffffffffffffffffffff21",
+				WebhookID: webhook.ID,
+				Event:     models.EventSnippetCreated,
+				Payload:   payload,
+				Status:    models.DeliveryPending,
+				Attempts:  tt.attempts,
+			}
+
+			start := time.Now()
+			delivery = app.sendWebhook(delivery, webhook)
+
+			assert.Equal(t, received.Method, http.MethodPost)
+			assert.Equal(t, string(body), string(payload))
+			assert.Equal(t, received.Header.Get("Content-Type"), "application/json")
+			assert.Equal(t, received.Header.Get(webhookEventHeader), models.EventSnippetCreated)
+			assert.Equal(t, received.Header.Get(webhookDeliveryHeader), "ffffffffffffffffffffff21")
+			// The HMAC-SHA256 of the body keyed with "s3cret"
+			assert.Equal(t, received.Header.Get(webhookSignatureHeader), "sha256=62d50361c648d7e19ad53a6860f117fd928ef6f2a8a055e79a024da94a0b3b5c")
+
+			assert.Equal(t, delivery.Status, tt.wantStatus)
+			assert.Equal(t, delivery.Attempts, tt.attempts+1)
+			assert.Equal(t, delivery.StatusCode, tt.wantStatusCode)
+			assert.Equal(t, delivery.Error, tt.wantError)
+
+			if tt.wantRetry > 0 {
+				retry := delivery.NextAttempt.Sub(start)
+				assert.Equal(t, retry >= tt.wantRetry && retry < tt.wantRetry+time.Second, true)
+			}
+		})
+	}
+}
+
+// A receiver which can't be reached is retried like one which fails
+func TestSendWebhookUnreachable(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	receiver.Close()
+
+	app := newTestApplication(t)
+
+	delivery := app.sendWebhook(models.Delivery{Event: models.EventSnippetDeleted}, models.Webhook{URL: receiver.URL, Secret: "s3cret"})
+	assert.Equal(t, delivery.Status, models.DeliveryPending)
+	assert.Equal(t, delivery.Attempts, 1)
+	assert.Equal(t, delivery.StatusCode, 0)
+	assert.StringContains(t, delivery.Error, "connection refused")
+}
+
+// The client of the application only connects to public addresses, so that
+// webhooks can't be used to reach the internal network of the server. The
+// receivers of the test are local, and names are checked once resolved
+func TestSendWebhookPrivateAddress(t *testing.T) {
+	received := false
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	u, err := url.Parse(receiver.URL)
+	assert.NilError(t, err)
+
+	app := newTestApplication(t)
+	app.webhookClient = newWebhookClient(false)
+
+	hosts := map[string]string{
+		"Address": u.Host,
+		"Name":    "localhost:" + u.Port(),
+	}
+
+	for name, host := range hosts {
+		t.Run(name, func(t *testing.T) {
+			webhook := models.Webhook{URL: "http://" + host + "/hooks", Secret: "s3cret"}
+
+			delivery := app.sendWebhook(models.Delivery{Event: models.EventSnippetDeleted}, webhook)
+			assert.Equal(t, received, false)
+			assert.Equal(t, delivery.Status, models.DeliveryPending)
+			assert.Equal(t, delivery.StatusCode, 0)
+			// The refused address isn't shown in the delivery log
+			assert.Equal(t, delivery.Error, "the webhook address isn't on the public internet")
+		})
+	}
+}
+
+// The expiry of a snippet is queued in advance, while the snippet itself is
+// deleted by the TTL index or the reaper. Run the worker over due expiry
+// deliveries and check that only the snippets which are really gone are sent
+func TestDeliverExpiredEvents(t *testing.T) {
+	tests := []struct {
+		name           string
+		snippetID      string
+		wantSent       bool
+		wantStatus     string
+		wantError      string
+		wantReschedule bool
+	}{
+		{
+			name:       "Deleted by the TTL index or the reaper",
+			snippetID:  "222222222222222222222222",
+			wantSent:   true,
+			wantStatus: models.DeliveryDelivered,
+		},
+		{
+			name:       "Burned",
+			snippetID:  "777777777777777777777777",
+			wantSent:   true,
+			wantStatus: models.DeliveryDelivered,
+		},
+		{
+			name:           "Expiry moved later",
+			snippetID:      "111111111111111111111111",
+			wantSent:       false,
+			wantStatus:     models.DeliveryPending,
+			wantReschedule: true,
+		},
+		{
+			name:       "No longer expires",
+			snippetID:  "999999999999999999999999",
+			wantSent:   false,
+			wantStatus: models.DeliveryCancelled,
+			wantError:  "the snippet no longer expires",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []string
+
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = append(received, r.Header.Get(webhookEventHeader))
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer receiver.Close()
+
+			app := newTestApplication(t)
+			webhooks := app.webhooks.(*mocks.WebhookModel)
+			webhooks.URL = receiver.URL
+
+			// Queue the expiry as it was when the snippet was saved
+			payload := []byte(`{"event":"snippet.expired","snippet":{"id":"` + tt.snippetID + `"}}`)
+			err := webhooks.Enqueue("111111111111111111111111", models.EventSnippetExpired, tt.snippetID, payload, time.Now().Add(-time.Minute))
+			assert.NilError(t, err)
+
+			app.deliverDueWebhooks()
+
+			assert.Equal(t, len(received) == 1, tt.wantSent)
+
+			enqueued := webhooks.Enqueued()
+			assert.Equal(t, len(enqueued), 1)
+			assert.Equal(t, enqueued[0].Status, tt.wantStatus)
+			assert.Equal(t, enqueued[0].Error, tt.wantError)
+
+			// A snippet which is still there gets the event when it expires,
+			// with its current expiry time
+			if tt.wantReschedule {
+				snippet, err := app.snippets.Get(tt.snippetID, "111111111111111111111111")
+				assert.NilError(t, err)
+				assert.Equal(t, enqueued[0].NextAttempt.Equal(snippet.Expires), true)
+				assert.Equal(t, enqueued[0].Attempts, 0)
+
+				var payload webhookPayload
+				err = json.Unmarshal(enqueued[0].Payload, &payload)
+				assert.NilError(t, err)
+				assert.Equal(t, payload.Snippet.Expires.Equal(snippet.Expires), true)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Define an Op type to tell whether a line was kept, added or removed
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Define a Line type to hold one line of a diff. Old and New are the 1-based
+// line numbers in the old and the new text, or 0 if the line isn't there
+type Line struct {
+	Op   Op
+	Text string
+	Old  int
+	New  int
+}
+
+// Returns the prefix of the line in the unified diff format
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// Define a Hunk type to hold a group of changed lines together with the
+// unchanged lines around them
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Returns the header of the hunk in the unified diff format, like
+// "@@ -1,4 +1,5 @@"
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Compare the old and the new text line by line and return every line of
+// both, in order. The lines which aren't changed are the longest common
+// subsequence of the two texts
+func Lines(old, new string) []Line {
+	a, b := split(old), split(new)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table, preferring removed lines before added ones, like most
+	// diff tools do
+	lines := make([]Line, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, Line{Op: Equal, Text: a[i], Old: i + 1, New: j + 1})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, Line{Op: Delete, Text: a[i], Old: i + 1})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: b[j], New: j + 1})
+			j++
+		}
+	}
+
+	return lines
+}
+
+// Compare the old and the new text line by line and return the changes as
+// hunks of a unified diff, with up to context unchanged lines around each
+// change. Changes which are closer than twice the context share a hunk. The
+// result is empty if the texts have the same lines
+func Unified(old, new string, context int) []Hunk {
+	lines := Lines(old, new)
+
+	var hunks []Hunk
+	start, end := -1, -1
+
+	for i, line := range lines {
+		if line.Op == Equal {
+			continue
+		}
+
+		// Close the current hunk if this change is too far away from it
+		if start >= 0 && i-context > end {
+			hunks = append(hunks, newHunk(lines, start, end))
+			start = -1
+		}
+		if start < 0 {
+			start = max(i-context, 0)
+		}
+		end = min(i+context+1, len(lines))
+	}
+
+	if start >= 0 {
+		hunks = append(hunks, newHunk(lines, start, end))
+	}
+
+	return hunks
+}
+
+// Create a hunk from lines[start:end]
+func newHunk(lines []Line, start, end int) Hunk {
+	h := Hunk{Lines: lines[start:end]}
+
+	// The line numbers the hunk starts after, in case it has no lines of
+	// the old or the new text
+	for _, line := range lines[:start] {
+		h.OldStart = max(h.OldStart, line.Old)
+		h.NewStart = max(h.NewStart, line.New)
+	}
+
+	for _, line := range h.Lines {
+		if line.Old > 0 {
+			h.OldLines++
+		}
+		if line.New > 0 {
+			h.NewLines++
+		}
+	}
+
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+
+	return h
+}
+
+// Split a text into lines. Windows line endings (which browsers send for
+// textarea content) are treated like Unix ones, and a final newline doesn't
+// start another line
+func split(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+)
+
+// Format hunks like the unified diff format, without the file headers
+func format(hunks []Hunk) string {
+	var b strings.Builder
+	for _, h := range hunks {
+		b.WriteString(h.Header() + "\n")
+		for _, line := range h.Lines {
+			b.WriteString(line.Prefix() + line.Text + "\n")
+		}
+	}
+	return b.String()
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{
+			name: "Same",
+			old:  "a\nb\n",
+			new:  "a\r\nb",
+			want: "",
+		},
+		{
+			name: "Changed line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "Added to empty",
+			old:  "",
+			new:  "a\nb\n",
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "Removed at end",
+			old:  "a\nb\nc\n",
+			new:  "a\nb\n",
+			want: "@@ -2,2 +2,1 @@\n b\n-c\n",
+		},
+		{
+			name: "Separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -9,2 +9,2 @@\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "Close changes share a hunk",
+			old:  "1\n2\n3\n4\n",
+			new:  "one\n2\n3\nfour\n",
+			want: "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n-4\n+four\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, format(Unified(tt.old, tt.new, 1)), tt.want)
+		})
+	}
+}
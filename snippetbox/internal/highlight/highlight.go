@@ -0,0 +1,159 @@
+package highlight
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Define a Language type to hold a language supported by the highlighter
+type Language struct {
+	// Value stored with the snippet, which is also the name of the Chroma lexer
+	Name string
+	// Human readable name shown to users
+	Label string
+	// File name extension used when the snippet is downloaded
+	Extension string
+}
+
+// Plaintext is the language used for content which isn't source code
+const Plaintext = "plaintext"
+
+// The languages which snippets can be highlighted in
+var Languages = []Language{
+	{Name: Plaintext, Label: "Plain text", Extension: "txt"},
+	{Name: "bash", Label: "Bash", Extension: "sh"},
+	{Name: "c", Label: "C", Extension: "c"},
+	{Name: "cpp", Label: "C++", Extension: "cpp"},
+	{Name: "css", Label: "CSS", Extension: "css"},
+	{Name: "docker", Label: "Dockerfile", Extension: "dockerfile"},
+	{Name: "go", Label: "Go", Extension: "go"},
+	{Name: "html", Label: "HTML", Extension: "html"},
+	{Name: "java", Label: "Java", Extension: "java"},
+	{Name: "javascript", Label: "JavaScript", Extension: "js"},
+	{Name: "json", Label: "JSON", Extension: "json"},
+	{Name: "markdown", Label: "Markdown", Extension: "md"},
+	{Name: "php", Label: "PHP", Extension: "php"},
+	{Name: "python", Label: "Python", Extension: "py"},
+	{Name: "ruby", Label: "Ruby", Extension: "rb"},
+	{Name: "rust", Label: "Rust", Extension: "rs"},
+	{Name: "sql", Label: "SQL", Extension: "sql"},
+	{Name: "typescript", Label: "TypeScript", Extension: "ts"},
+	{Name: "yaml", Label: "YAML", Extension: "yaml"},
+}
+
+// The formatter writes CSS classes instead of inline styles, because the
+// Content-Security-Policy of the application doesn't allow inline styles.
+// The classes are defined in ui/static/css/highlight.css (see WriteCSS)
+var formatter = html.New(html.WithClasses(true))
+
+// The style the stylesheet is generated from
+var style = styles.Get("github")
+
+// Returns the names of all the supported languages
+func Names() []string {
+	names := make([]string, len(Languages))
+	for i, language := range Languages {
+		names[i] = language.Name
+	}
+	return names
+}
+
+// Returns the human readable name of a language, or the name itself for
+// unknown languages
+func Label(name string) string {
+	for _, language := range Languages {
+		if language.Name == name {
+			return language.Label
+		}
+	}
+	return name
+}
+
+// Returns the file name extension of a language, or "txt" for unknown languages
+func Extension(name string) string {
+	for _, language := range Languages {
+		if language.Name == name {
+			return language.Extension
+		}
+	}
+	return "txt"
+}
+
+// Guess the language of the content. Plaintext is returned if the language
+// can't be recognised or isn't one of the supported languages
+func Detect(content string) string {
+	return supported(lexers.Analyse(content))
+}
+
+// Guess the language of a file from its name, like "main.go", or from its
+// content if the name doesn't tell
+func DetectFile(name string, content string) string {
+	if language := supported(lexers.Match(name)); language != Plaintext {
+		return language
+	}
+	return Detect(content)
+}
+
+// Return the name of the supported language the lexer is for, or Plaintext
+func supported(lexer chroma.Lexer) string {
+	if lexer == nil {
+		return Plaintext
+	}
+
+	detected := lexer.Config().Name
+	for _, language := range Languages {
+		if l := lexers.Get(language.Name); l != nil && l.Config().Name == detected {
+			return language.Name
+		}
+	}
+
+	return Plaintext
+}
+
+// Render the content as HTML with syntax highlighting for the language. The
+// content is escaped by the formatter, so the result is safe to be used in
+// templates as is
+func HTML(content, language string) (template.HTML, error) {
+	return render(formatter, content, language)
+}
+
+// Render the content like HTML() does, with a number before every line. The
+// numbers link to themselves, with the prefix and the number as the id (like
+// "L12"), so that a line can be linked to
+func NumberedHTML(content, language, prefix string) (template.HTML, error) {
+	numbered := html.New(html.WithClasses(true), html.WithLineNumbers(true), html.WithLinkableLineNumbers(true, prefix))
+	return render(numbered, content, language)
+}
+
+// Render the content as HTML with the formatter
+func render(formatter *html.Formatter, content, language string) (template.HTML, error) {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = formatter.Format(&buf, style, iterator)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(buf.String()), nil
+}
+
+// Write the stylesheet with the classes used by HTML()
+func WriteCSS(w io.Writer) error {
+	return formatter.WriteCSS(w, style)
+}
@@ -0,0 +1,100 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "Go",
+			content: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"Hello\")\n}\n",
+			want:    "go",
+		},
+		{
+			name:    "Shebang",
+			content: "#!/bin/bash\necho hello\n",
+			want:    "bash",
+		},
+		{
+			name:    "Prose",
+			content: "An old silent pond...",
+			want:    Plaintext,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, Detect(tt.content), tt.want)
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	html, err := HTML("<script>alert('pond')</script>", "plaintext")
+	assert.NilError(t, err)
+
+	// The content must be escaped
+	if strings.Contains(string(html), "<script>") {
+		t.Errorf("got: %q; expected escaped content", html)
+	}
+
+	html, err = HTML("func main() {}", "go")
+	assert.NilError(t, err)
+	assert.StringContains(t, string(html), `<pre class="chroma">`)
+	assert.StringContains(t, string(html), `<span class="kd">func</span>`)
+}
+
+func TestDetectFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     string
+	}{
+		{
+			name:     "Extension",
+			filename: "config.yaml",
+			content:  "port: 4000\n",
+			want:     "yaml",
+		},
+		{
+			name:     "Dockerfile",
+			filename: "Dockerfile",
+			content:  "FROM golang:1.22\n",
+			want:     "docker",
+		},
+		{
+			name:     "Unknown extension",
+			filename: "run",
+			content:  "#!/bin/bash\necho hello\n",
+			want:     "bash",
+		},
+		{
+			name:     "Unknown",
+			filename: "notes",
+			content:  "An old silent pond...",
+			want:     Plaintext,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, DetectFile(tt.filename, tt.content), tt.want)
+		})
+	}
+}
+
+func TestNumberedHTML(t *testing.T) {
+	html, err := NumberedHTML("a\nb\n", "plaintext", "L")
+	assert.NilError(t, err)
+	assert.StringContains(t, string(html), `<span class="ln" id="L1"><a class="lnlinks" href="#L1">1</a></span>`)
+	assert.StringContains(t, string(html), `<span class="ln" id="L2"><a class="lnlinks" href="#L2">2</a></span>`)
+}
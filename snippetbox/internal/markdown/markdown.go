@@ -0,0 +1,85 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/highlight"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// Language is the snippet language whose content is rendered as Markdown
+const Language = "markdown"
+
+// The Markdown converter supports GitHub Flavored Markdown and highlights
+// fenced code blocks. Raw HTML in the source is omitted by goldmark, since
+// the unsafe renderer option isn't enabled
+var converter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{}, 100)),
+	),
+)
+
+// The sanitizer only lets through the elements and attributes which are
+// allowed in user generated content, plus the classes used by the highlighter
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-z][a-z0-9 -]*$`)).OnElements("pre", "code", "span")
+	return p
+}()
+
+// Render the Markdown source as sanitized HTML. Only the output of the
+// sanitizer is converted to template.HTML, so the result is safe to be used
+// in templates
+func HTML(source string) (template.HTML, error) {
+	var buf bytes.Buffer
+	err := converter.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeReader(&buf).String()), nil
+}
+
+// Define a codeBlockRenderer type which renders fenced code blocks with
+// syntax highlighting in the language given after the opening fence
+type codeBlockRenderer struct{}
+
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r *codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+
+	// Collect the lines of the code block
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	html, err := highlight.HTML(code.String(), string(n.Language(source)))
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	_, err = w.WriteString(string(html))
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	return ast.WalkSkipChildren, nil
+}
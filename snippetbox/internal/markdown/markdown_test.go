@@ -0,0 +1,58 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    string
+		notWant string
+	}{
+		{
+			name:   "Heading",
+			source: "# An old silent pond",
+			want:   "<h1>An old silent pond</h1>",
+		},
+		{
+			name:   "Fenced code block",
+			source: "```go\nfunc main() {}\n```\n",
+			want:   `<span class="kd">func</span>`,
+		},
+		{
+			name:    "Raw HTML",
+			source:  "<script>alert('pond')</script>",
+			notWant: "<script>",
+		},
+		{
+			name:    "Script link",
+			source:  "[pond](javascript:alert('pond'))",
+			notWant: "javascript:",
+		},
+		{
+			name:    "Event handler",
+			source:  "```go\nfunc main() {}\n```\n<span onclick=\"alert('pond')\">pond</span>",
+			notWant: "onclick",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := HTML(tt.source)
+			assert.NilError(t, err)
+
+			if tt.want != "" {
+				assert.StringContains(t, string(html), tt.want)
+			}
+
+			if tt.notWant != "" && strings.Contains(string(html), tt.notWant) {
+				t.Errorf("got: %q; expected not to contain: %q", html, tt.notWant)
+			}
+		})
+	}
+}
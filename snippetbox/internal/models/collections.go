@@ -0,0 +1,344 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CollectionModelInterface interface {
+	Insert(collection Collection) (string, error)
+	Get(id string, viewerID string) (Collection, error)
+	Update(collection Collection) error
+	Delete(id string, userID string) error
+	ByOwner(userID string) ([]Collection, error)
+	AddSnippet(id string, userID string, snippetID string) error
+	RemoveSnippet(id string, userID string, snippetID string) error
+	MoveSnippet(id string, userID string, snippetID string, offset int) error
+	RemoveFromAll(snippetID string) error
+}
+
+// Define a Collection type to hold a named, ordered list of snippets of a
+// user. The snippets aren't owned by the collection: a snippet can be in
+// several collections, and can be in the collections of other users
+type Collection struct {
+	ID          string `bson:"_id,omitempty"`
+	Name        string
+	Description string
+	// Who can see the collection, one of the Visibilities
+	Visibility string
+	// IDs of the snippets in the collection, in order
+	SnippetIDs []string `bson:"snippet_ids"`
+	// ID of the user who owns the collection and their name
+	UserID  string `bson:"user_id"`
+	Author  string
+	Created time.Time
+}
+
+// Define a CollectionModel type which wraps a database connection pool. The
+// snippet ids are stored as ObjectIDs, and decoded into strings
+type CollectionModel struct {
+	DB *mongo.Database
+}
+
+// This will store a new empty collection and return its id. The name,
+// description, visibility and owner (UserID) are taken from the collection
+func (m *CollectionModel) Insert(collection Collection) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(collection.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	doc := bson.D{
+		{Key: "name", Value: collection.Name},
+		{Key: "description", Value: collection.Description},
+		{Key: "visibility", Value: collection.Visibility},
+		{Key: "snippet_ids", Value: bson.A{}},
+		{Key: "user_id", Value: ownerID},
+		{Key: "created", Value: time.Now()},
+	}
+
+	result, err := m.DB.Collection("collections").InsertOne(ctx, doc)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("models: unexpected id type %T", result.InsertedID)
+	}
+
+	return id.Hex(), nil
+}
+
+// This will return the collection with the name of its owner as the Author.
+// Private collections are only returned to their owner, other viewers get
+// ErrNoRecord
+func (m *CollectionModel) Get(id string, viewerID string) (Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any collection
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Collection{}, ErrNoRecord
+	}
+
+	visible := bson.A{bson.D{{Key: "visibility", Value: bson.D{{Key: "$ne", Value: VisibilityPrivate}}}}}
+	if viewerID != "" {
+		viewerObjID, err := primitive.ObjectIDFromHex(viewerID)
+		if err != nil {
+			return Collection{}, err
+		}
+		visible = append(visible, bson.D{{Key: "user_id", Value: viewerObjID}})
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: objID},
+		{Key: "$or", Value: visible},
+	}
+
+	collections, err := m.find(ctx, filter)
+	if err != nil {
+		return Collection{}, err
+	}
+
+	if len(collections) == 0 {
+		return Collection{}, ErrNoRecord
+	}
+
+	return collections[0], nil
+}
+
+// This will change the name, description and visibility of the collection.
+// Only the owner (UserID) can change it
+func (m *CollectionModel) Update(collection Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, err := m.ownerFilter(ctx, collection.ID, collection.UserID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "name", Value: collection.Name},
+		{Key: "description", Value: collection.Description},
+		{Key: "visibility", Value: collection.Visibility},
+	}}}
+
+	_, err = m.DB.Collection("collections").UpdateOne(ctx, filter, update)
+	return err
+}
+
+// This will delete the collection, but none of its snippets. Only the owner
+// can delete it
+func (m *CollectionModel) Delete(id string, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, err := m.ownerFilter(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("collections").DeleteOne(ctx, filter)
+	return err
+}
+
+// This will return all the collections of the user, sorted by name
+func (m *CollectionModel) ByOwner(userID string) ([]Collection, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.find(ctx, bson.D{{Key: "user_id", Value: ownerID}})
+}
+
+// This will add the snippet at the end of the collection, unless it is
+// already in it. Only the owner of the collection can add snippets
+func (m *CollectionModel) AddSnippet(id string, userID string, snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, err := m.ownerFilter(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	snippetObjID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	// $addToSet would keep the list free of duplicates too, but it doesn't
+	// promise to add at the end
+	filter = append(filter, bson.E{Key: "snippet_ids", Value: bson.D{{Key: "$ne", Value: snippetObjID}}})
+	update := bson.D{{Key: "$push", Value: bson.D{{Key: "snippet_ids", Value: snippetObjID}}}}
+
+	_, err = m.DB.Collection("collections").UpdateOne(ctx, filter, update)
+	return err
+}
+
+// This will remove the snippet from the collection. Only the owner of the
+// collection can remove snippets
+func (m *CollectionModel) RemoveSnippet(id string, userID string, snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, err := m.ownerFilter(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	snippetObjID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "snippet_ids", Value: snippetObjID}}}}
+
+	_, err = m.DB.Collection("collections").UpdateOne(ctx, filter, update)
+	return err
+}
+
+// This will move the snippet offset places towards the end of the collection,
+// or towards the start if offset is negative. The snippet stops at the start
+// or the end. Only the owner of the collection can reorder it. Returns
+// ErrNoRecord if the snippet isn't in the collection
+func (m *CollectionModel) MoveSnippet(id string, userID string, snippetID string, offset int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter, err := m.ownerFilter(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	snippetObjID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	var current struct {
+		SnippetIDs []primitive.ObjectID `bson:"snippet_ids"`
+	}
+
+	collection := m.DB.Collection("collections")
+	opts := options.FindOne().SetProjection(bson.D{{Key: "snippet_ids", Value: 1}})
+
+	err = collection.FindOne(ctx, filter, opts).Decode(&current)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	ids := current.SnippetIDs
+	from := slices.Index(ids, snippetObjID)
+	if from < 0 {
+		return ErrNoRecord
+	}
+
+	to := min(max(from+offset, 0), len(ids)-1)
+	ids = slices.Insert(slices.Delete(ids, from, from+1), to, snippetObjID)
+
+	// Only save the new order if nobody changed the list in the meantime
+	filter = append(filter, bson.E{Key: "snippet_ids", Value: current.SnippetIDs})
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "snippet_ids", Value: ids}}}}
+
+	_, err = collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// This will remove the snippet from all the collections it is in
+func (m *CollectionModel) RemoveFromAll(snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snippetObjID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("collections").UpdateMany(ctx,
+		bson.D{{Key: "snippet_ids", Value: snippetObjID}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "snippet_ids", Value: snippetObjID}}}},
+	)
+	return err
+}
+
+// Return the filter which matches the collection if it belongs to the user.
+// Returns ErrNoRecord if there is no such collection and ErrNotOwner if it
+// belongs to another user
+func (m *CollectionModel) ownerFilter(ctx context.Context, id string, userID string) (bson.D, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNoRecord
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{{Key: "_id", Value: objID}}
+
+	var result struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+
+	opts := options.FindOne().SetProjection(bson.D{{Key: "user_id", Value: 1}})
+
+	err = m.DB.Collection("collections").FindOne(ctx, filter, opts).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	if result.UserID != ownerID {
+		return nil, ErrNotOwner
+	}
+
+	return append(filter, bson.E{Key: "user_id", Value: ownerID}), nil
+}
+
+// Return the collections matching filter, sorted by name, with the name of
+// the owner of each of them as the Author
+func (m *CollectionModel) find(ctx context.Context, filter bson.D) ([]Collection, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}}},
+	}
+	pipeline = append(pipeline, authorStages()...)
+
+	cursor, err := m.DB.Collection("collections").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var collections []Collection
+	if err := cursor.All(ctx, &collections); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CommentModelInterface interface {
+	Insert(comment Comment) (string, error)
+	Get(id string) (Comment, error)
+	BySnippet(snippetID string) ([]Comment, error)
+	Delete(id string) error
+	DeleteAll(snippetID string) error
+}
+
+// Define a Comment type to hold a comment on a snippet. Comments can be
+// replied to, but replies can't, so there is a single level of replies
+type Comment struct {
+	ID        string `bson:"_id,omitempty"`
+	SnippetID string `bson:"snippet_id"`
+	// ID of the comment this one replies to, if any
+	ParentID string `bson:"parent_id,omitempty"`
+	// Line of the snippet content the comment is about, if any. Lines are
+	// numbered from 1
+	Line int `bson:"line,omitempty"`
+	Body string
+	// ID of the user who wrote the comment and their name
+	UserID  string `bson:"user_id"`
+	Author  string
+	Created time.Time
+}
+
+// Define a CommentModel type which wraps a database connection pool
+type CommentModel struct {
+	DB *mongo.Database
+}
+
+// This will store a new comment and return its id. The snippet, parent
+// comment, line, body and author (UserID) are taken from the comment
+func (m *CommentModel) Insert(comment Comment) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snippetID, err := primitive.ObjectIDFromHex(comment.SnippetID)
+	if err != nil {
+		return "", err
+	}
+
+	userID, err := primitive.ObjectIDFromHex(comment.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	doc := bson.D{
+		{Key: "snippet_id", Value: snippetID},
+		{Key: "body", Value: comment.Body},
+		{Key: "user_id", Value: userID},
+		{Key: "created", Value: time.Now()},
+	}
+
+	if comment.ParentID != "" {
+		parentID, err := primitive.ObjectIDFromHex(comment.ParentID)
+		if err != nil {
+			return "", err
+		}
+		doc = append(doc, bson.E{Key: "parent_id", Value: parentID})
+	}
+
+	if comment.Line > 0 {
+		doc = append(doc, bson.E{Key: "line", Value: comment.Line})
+	}
+
+	result, err := m.DB.Collection("comments").InsertOne(ctx, doc)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("models: unexpected id type %T", result.InsertedID)
+	}
+
+	return id.Hex(), nil
+}
+
+// This will return one comment, or ErrNoRecord if there is no such comment
+func (m *CommentModel) Get(id string) (Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any comment
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Comment{}, ErrNoRecord
+	}
+
+	var comment Comment
+	err = m.DB.Collection("comments").FindOne(ctx, bson.D{{Key: "_id", Value: objID}}).Decode(&comment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Comment{}, ErrNoRecord
+		}
+		return Comment{}, err
+	}
+
+	return comment, nil
+}
+
+// This will return all the comments on the snippet, replies included, oldest
+// first, with the name of the user who wrote each of them as the Author
+func (m *CommentModel) BySnippet(snippetID string) ([]Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "snippet_id", Value: objID}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created", Value: 1}, {Key: "_id", Value: 1}}}},
+	}
+	pipeline = append(pipeline, authorStages()...)
+
+	cursor, err := m.DB.Collection("comments").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var comments []Comment
+	if err := cursor.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// This will remove the comment together with its replies
+func (m *CommentModel) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any comment
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNoRecord
+	}
+
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "_id", Value: objID}},
+		bson.D{{Key: "parent_id", Value: objID}},
+	}}}
+
+	result, err := m.DB.Collection("comments").DeleteMany(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will remove all the comments on the snippet
+func (m *CommentModel) DeleteAll(snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("comments").DeleteMany(ctx, bson.D{{Key: "snippet_id", Value: objID}})
+	return err
+}
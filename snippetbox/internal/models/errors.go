@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -14,4 +15,16 @@ var (
 	// Add a new ErrDuplicateEmail error if a user
 	// tries to signup with an email address that's already in use
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+
+	// Add a new ErrNotOwner error if a user tries to change
+	// a record which belongs to another user
+	ErrNotOwner = errors.New("models: not the owner of the record")
+
+	// Add a new ErrInvalidCursor error if a pagination cursor
+	// can't be decoded
+	ErrInvalidCursor = errors.New("models: invalid cursor")
+
+	// Add a new ErrBurned error if a burn after reading snippet has
+	// already been read. It wraps ErrNoRecord, since the snippet is gone
+	ErrBurned = fmt.Errorf("%w: snippet has been burned", ErrNoRecord)
 )
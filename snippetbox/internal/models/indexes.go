@@ -0,0 +1,178 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Make sure the indexes which the models rely on exist. Creating an index which
+// already exists with the same specification is a no-op, so this is safe to
+// call every time the application starts
+func EnsureIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Email addresses of users must be unique (see UserModel.Insert)
+	_, err := db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_index").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Full-text search over the title and content of snippets (see SnippetModel.Search)
+	_, err = db.Collection("snippets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "title", Value: "text"},
+			{Key: "content", Value: "text"},
+		},
+		Options: options.Index().SetName("text_index"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let MongoDB delete snippets once they expire. Snippets which never expire
+	// have no expiry time, and the TTL monitor leaves them alone
+	_, err = db.Collection("snippets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetName("expires_ttl_index").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The tombstones of burned snippets (see SnippetModel.Burn) only have to
+	// outlive the links which were shared, so MongoDB deletes them after a while
+	_, err = db.Collection("burned_snippets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "burned", Value: 1}},
+		Options: options.Index().SetName("burned_ttl_index").SetExpireAfterSeconds(int32(burnedTombstoneLifetime.Seconds())),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Snippets are listed by tag (see SnippetModel.ByTag). An index on an
+	// array field holds an entry for every item
+	_, err = db.Collection("snippets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tags", Value: 1}},
+		Options: options.Index().SetName("tags_index"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Revisions expire with their snippet (see RevisionModel.Insert)
+	_, err = db.Collection("snippet_revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires", Value: 1}},
+		Options: options.Index().SetName("revision_expires_ttl_index").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Every revision number is used once per snippet (see RevisionModel.Insert)
+	_, err = db.Collection("snippet_revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "snippet_id", Value: 1},
+			{Key: "number", Value: 1},
+		},
+		Options: options.Index().SetName("revision_index").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// A user can star a snippet once. The index also serves the lists of the
+	// snippets starred by a user
+	_, err = db.Collection("stars").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user_id", Value: 1},
+			{Key: "snippet_id", Value: 1},
+		},
+		Options: options.Index().SetName("star_index").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Comments are listed by snippet, oldest first (see CommentModel.BySnippet)
+	_, err = db.Collection("comments").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "snippet_id", Value: 1},
+			{Key: "created", Value: 1},
+		},
+		Options: options.Index().SetName("comment_index"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Collections are listed by owner, and a deleted snippet is removed from
+	// all the collections holding it (see CollectionModel.RemoveFromAll)
+	_, err = db.Collection("collections").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetName("collection_owner_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "snippet_ids", Value: 1}},
+			Options: options.Index().SetName("collection_snippets_index"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tokens are looked up by their hash (see TokenModel.Authenticate), and
+	// listed by owner
+	_, err = db.Collection("tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetName("token_hash_index").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created", Value: -1}},
+			Options: options.Index().SetName("token_owner_index"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("webhooks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("webhook_owner_index"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The delivery queue is polled for due deliveries (see
+	// WebhookModel.Claim), listed by user in the delivery log, and scheduled
+	// deliveries are cancelled by snippet
+	_, err = db.Collection("webhook_deliveries").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}},
+			Options: options.Index().SetName("delivery_queue_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "updated", Value: -1}},
+			Options: options.Index().SetName("delivery_log_index"),
+		},
+		{
+			Keys:    bson.D{{Key: "snippet_id", Value: 1}, {Key: "event", Value: 1}},
+			Options: options.Index().SetName("delivery_snippet_index"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package mocks
+
+import (
+	"slices"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+)
+
+// A public collection of the mocked authenticated user. It holds a private
+// snippet of another user, which the owner of the collection can't see
+var mockCollection = models.Collection{
+	ID:          "dddddddddddddddddddddd01",
+	Name:        "Pond poems",
+	Description: "Everything about ponds",
+	Visibility:  models.VisibilityPublic,
+	SnippetIDs:  []string{mockSnippet.ID, mockForeignSnippet.ID, mockPrivateSnippet.ID},
+	UserID:      mockSnippet.UserID,
+	Author:      mockSnippet.Author,
+	Created:     time.Now(),
+}
+
+// A private collection of another user
+var mockPrivateCollection = models.Collection{
+	ID:         "dddddddddddddddddddddd02",
+	Name:       "Drafts",
+	Visibility: models.VisibilityPrivate,
+	SnippetIDs: []string{mockForeignSnippet.ID},
+	UserID:     mockForeignSnippet.UserID,
+	Author:     mockForeignSnippet.Author,
+	Created:    time.Now(),
+}
+
+type CollectionModel struct{}
+
+func (m *CollectionModel) Insert(collection models.Collection) (string, error) {
+	return "dddddddddddddddddddddd03", nil
+}
+
+func (m *CollectionModel) Get(id string, viewerID string) (models.Collection, error) {
+	switch id {
+	case mockCollection.ID:
+		return mockCollection, nil
+	case mockPrivateCollection.ID:
+		if viewerID == mockPrivateCollection.UserID {
+			return mockPrivateCollection, nil
+		}
+		return models.Collection{}, models.ErrNoRecord
+	default:
+		return models.Collection{}, models.ErrNoRecord
+	}
+}
+
+func (m *CollectionModel) Update(collection models.Collection) error {
+	return checkCollectionOwner(collection.ID, collection.UserID)
+}
+
+func (m *CollectionModel) Delete(id string, userID string) error {
+	return checkCollectionOwner(id, userID)
+}
+
+func (m *CollectionModel) ByOwner(userID string) ([]models.Collection, error) {
+	switch userID {
+	case mockCollection.UserID:
+		return []models.Collection{mockCollection}, nil
+	case mockPrivateCollection.UserID:
+		return []models.Collection{mockPrivateCollection}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *CollectionModel) AddSnippet(id string, userID string, snippetID string) error {
+	return checkCollectionOwner(id, userID)
+}
+
+func (m *CollectionModel) RemoveSnippet(id string, userID string, snippetID string) error {
+	return checkCollectionOwner(id, userID)
+}
+
+func (m *CollectionModel) MoveSnippet(id string, userID string, snippetID string, offset int) error {
+	err := checkCollectionOwner(id, userID)
+	if err != nil {
+		return err
+	}
+	if id == mockCollection.ID && !slices.Contains(mockCollection.SnippetIDs, snippetID) {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *CollectionModel) RemoveFromAll(snippetID string) error {
+	return nil
+}
+
+// Mimic the ownership checks of the collection model
+func checkCollectionOwner(id string, userID string) error {
+	switch id {
+	case mockCollection.ID:
+		if userID != mockCollection.UserID {
+			return models.ErrNotOwner
+		}
+		return nil
+	case mockPrivateCollection.ID:
+		if userID != mockPrivateCollection.UserID {
+			return models.ErrNotOwner
+		}
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
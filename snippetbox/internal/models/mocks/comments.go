@@ -0,0 +1,81 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+)
+
+// Comments on mockSnippet, which belongs to the mocked authenticated user, and
+// on mockForeignSnippet, which doesn't. Each of them has a comment by another
+// user and one by the mocked authenticated user
+var mockComments = []models.Comment{
+	{
+		ID:        "cccccccccccccccccccccc01",
+		SnippetID: mockSnippet.ID,
+		Line:      1,
+		Body:      "What a quiet first line",
+		UserID:    mockForeignSnippet.UserID,
+		Author:    mockForeignSnippet.Author,
+		Created:   time.Now().Add(-time.Hour),
+	},
+	{
+		ID:        "cccccccccccccccccccccc02",
+		SnippetID: mockSnippet.ID,
+		ParentID:  "cccccccccccccccccccccc01",
+		Body:      "Thank you!",
+		UserID:    mockSnippet.UserID,
+		Author:    mockSnippet.Author,
+		Created:   time.Now(),
+	},
+	{
+		ID:        "cccccccccccccccccccccc03",
+		SnippetID: mockForeignSnippet.ID,
+		Body:      "Splash!",
+		UserID:    mockForeignSnippet.UserID,
+		Author:    mockForeignSnippet.Author,
+		Created:   time.Now().Add(-time.Hour),
+	},
+	{
+		ID:        "cccccccccccccccccccccc04",
+		SnippetID: mockForeignSnippet.ID,
+		Body:      "Nice one",
+		UserID:    mockSnippet.UserID,
+		Author:    mockSnippet.Author,
+		Created:   time.Now(),
+	},
+}
+
+type CommentModel struct{}
+
+func (m *CommentModel) Insert(comment models.Comment) (string, error) {
+	return "cccccccccccccccccccccc05", nil
+}
+
+func (m *CommentModel) Get(id string) (models.Comment, error) {
+	for _, comment := range mockComments {
+		if comment.ID == id {
+			return comment, nil
+		}
+	}
+	return models.Comment{}, models.ErrNoRecord
+}
+
+func (m *CommentModel) BySnippet(snippetID string) ([]models.Comment, error) {
+	var comments []models.Comment
+	for _, comment := range mockComments {
+		if comment.SnippetID == snippetID {
+			comments = append(comments, comment)
+		}
+	}
+	return comments, nil
+}
+
+func (m *CommentModel) Delete(id string) error {
+	_, err := m.Get(id)
+	return err
+}
+
+func (m *CommentModel) DeleteAll(snippetID string) error {
+	return nil
+}
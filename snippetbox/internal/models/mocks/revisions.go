@@ -0,0 +1,63 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+)
+
+// The revisions of mockSnippet, newest first. The latest one matches the
+// snippet itself
+var mockRevisions = []models.Revision{
+	{
+		ID:        "999999999999999999999992",
+		SnippetID: mockSnippet.ID,
+		Number:    2,
+		Title:     mockSnippet.Title,
+		Content:   mockSnippet.Content,
+		Language:  mockSnippet.Language,
+		UserID:    mockSnippet.UserID,
+		Author:    mockSnippet.Author,
+		Created:   time.Now(),
+	},
+	{
+		ID:        "999999999999999999999991",
+		SnippetID: mockSnippet.ID,
+		Number:    1,
+		Title:     "An old pond",
+		Content:   "An old pond",
+		Language:  mockSnippet.Language,
+		UserID:    mockSnippet.UserID,
+		Author:    mockSnippet.Author,
+		Created:   time.Now().Add(-time.Hour),
+	},
+}
+
+type RevisionModel struct{}
+
+func (m *RevisionModel) Insert(snippet models.Snippet, userID string) (int, error) {
+	if snippet.ID == mockSnippet.ID {
+		return len(mockRevisions) + 1, nil
+	}
+	return 1, nil
+}
+
+func (m *RevisionModel) Get(snippetID string, number int) (models.Revision, error) {
+	for _, revision := range mockRevisions {
+		if revision.SnippetID == snippetID && revision.Number == number {
+			return revision, nil
+		}
+	}
+	return models.Revision{}, models.ErrNoRecord
+}
+
+func (m *RevisionModel) All(snippetID string) ([]models.Revision, error) {
+	if snippetID == mockSnippet.ID {
+		return mockRevisions, nil
+	}
+	return nil, nil
+}
+
+func (m *RevisionModel) DeleteAll(snippetID string) error {
+	return nil
+}
@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
@@ -8,24 +10,142 @@ import (
 )
 
 var mockSnippet = models.Snippet{
-	ID:      "111111111111111111111111",
-	Title:   "An old silent pond",
-	Content: "An old silent pond...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         "111111111111111111111111",
+	Title:      "An old silent pond",
+	Content:    "An old silent pond...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	UserID:     "111111111111111111111111",
+	Author:     "Alice Jones",
+	Forks:      1,
+	Tags:       []string{"haiku", "nature"},
 }
 
+// A snippet which belongs to another user than the mocked authenticated one,
+// forked from mockSnippet
+var mockForeignSnippet = models.Snippet{
+	ID:         "333333333333333333333333",
+	Title:      "A frog jumps into the pond",
+	Content:    "A frog jumps into the pond...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	UserID:     "222222222222222222222222",
+	Author:     "Bob Smith",
+	ForkedFrom: "111111111111111111111111",
+	Stars:      1,
+}
+
+// A private snippet of another user than the mocked authenticated one
+var mockPrivateSnippet = models.Snippet{
+	ID:         "444444444444444444444444",
+	Title:      "Over the wintry forest",
+	Content:    "Over the wintry forest...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityPrivate,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	UserID:     "222222222222222222222222",
+	Author:     "Bob Smith",
+}
+
+// A snippet of another user than the mocked authenticated one, which is
+// protected by the passphrase "open sesame"
+var mockProtectedSnippet = models.Snippet{
+	ID:               "555555555555555555555555",
+	Title:            "Lightning flash",
+	Content:          "Lightning flash...",
+	Language:         "plaintext",
+	Visibility:       models.VisibilityPublic,
+	Created:          time.Now(),
+	Expires:          time.Now().Add(24 * time.Hour),
+	UserID:           "222222222222222222222222",
+	Author:           "Bob Smith",
+	HashedPassphrase: []byte("$2a$12$open.sesame"),
+}
+
+// A burn after reading snippet of the mocked authenticated user
+var mockBurnSnippet = models.Snippet{
+	ID:               "666666666666666666666666",
+	Title:            "In the cicada's cry",
+	Content:          "In the cicada's cry...",
+	Language:         "plaintext",
+	Visibility:       models.VisibilityPublic,
+	Created:          time.Now(),
+	Expires:          time.Now().Add(24 * time.Hour),
+	UserID:           "111111111111111111111111",
+	Author:           "Alice Jones",
+	BurnAfterReading: true,
+}
+
+// A snippet of another user than the mocked authenticated one, with more
+// than one file
+var mockMultiFileSnippet = models.Snippet{
+	ID:         "aaaaaaaaaaaaaaaaaaaaaaaa",
+	Title:      "Hello module",
+	Content:    "package main\n\nfunc main() {}\n",
+	Language:   "go",
+	Filename:   "main.go",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now().Add(24 * time.Hour),
+	UserID:     "222222222222222222222222",
+	Author:     "Bob Smith",
+	Files: []models.File{
+		{Name: "go.mod", Content: "module hello\n", Language: "plaintext"},
+		{Name: "README.md", Content: "# Hello\n", Language: "markdown"},
+	},
+}
+
+// A snippet of the mocked authenticated user which never expires
+var mockPermanentSnippet = models.Snippet{
+	ID:         "999999999999999999999999",
+	Title:      "Over the wintry forest",
+	Content:    "Over the wintry forest...",
+	Language:   "plaintext",
+	Visibility: models.VisibilityUnlisted,
+	Created:    time.Now(),
+	UserID:     "111111111111111111111111",
+	Author:     "Alice Jones",
+}
+
+// The ID of a burn after reading snippet which has already been read
+const mockBurnedSnippetID = "777777777777777777777777"
+
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (interface{}, error) {
+func (m *SnippetModel) Insert(snippet models.Snippet, passphrase string) (interface{}, error) {
+	if snippet.BurnAfterReading {
+		return primitive.ObjectIDFromHex(mockBurnSnippet.ID)
+	}
 	objectID, _ := primitive.ObjectIDFromHex("222222222222222222222222")
 	return objectID, nil
 }
 
-func (m *SnippetModel) Get(id string) (models.Snippet, error) {
+func (m *SnippetModel) Get(id string, viewerID string) (models.Snippet, error) {
 	switch id {
-	case "111111111111111111111111":
+	case mockSnippet.ID:
 		return mockSnippet, nil
+	case mockForeignSnippet.ID:
+		return mockForeignSnippet, nil
+	case mockPrivateSnippet.ID:
+		if viewerID == mockPrivateSnippet.UserID {
+			return mockPrivateSnippet, nil
+		}
+		return models.Snippet{}, models.ErrNoRecord
+	case mockProtectedSnippet.ID:
+		return mockProtectedSnippet, nil
+	case mockBurnSnippet.ID:
+		return mockBurnSnippet, nil
+	case mockMultiFileSnippet.ID:
+		return mockMultiFileSnippet, nil
+	case mockPermanentSnippet.ID:
+		return mockPermanentSnippet, nil
+	case mockBurnedSnippetID:
+		return models.Snippet{}, models.ErrBurned
 	default:
 		return models.Snippet{}, models.ErrNoRecord
 	}
@@ -34,3 +154,125 @@ func (m *SnippetModel) Get(id string) (models.Snippet, error) {
 func (m *SnippetModel) Latest() ([]models.Snippet, error) {
 	return []models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) Update(snippet models.Snippet) error {
+	return checkOwner(snippet.ID, snippet.UserID)
+}
+
+func (m *SnippetModel) Delete(id string, userID string) error {
+	return checkOwner(id, userID)
+}
+
+func (m *SnippetModel) ByOwner(userID string, page int, pageSize int, sort string, includeExpired bool) ([]models.Snippet, int, error) {
+	switch userID {
+	case mockSnippet.UserID:
+		return []models.Snippet{mockSnippet}, 1, nil
+	case mockForeignSnippet.UserID:
+		return []models.Snippet{mockForeignSnippet}, 1, nil
+	default:
+		return nil, 0, nil
+	}
+}
+
+func (m *SnippetModel) Browse(filter models.SnippetFilter) ([]models.Snippet, string, error) {
+	switch filter.Author {
+	case "", mockSnippet.UserID:
+		return []models.Snippet{mockSnippet}, "", nil
+	default:
+		return nil, "", nil
+	}
+}
+
+// Like the model, the search skips the snippets protected by a passphrase
+func (m *SnippetModel) Search(query string, page int, pageSize int) ([]models.Snippet, int, error) {
+	var snippets []models.Snippet
+	for _, snippet := range []models.Snippet{mockSnippet, mockProtectedSnippet} {
+		if snippet.IsProtected() {
+			continue
+		}
+		if strings.Contains(strings.ToLower(snippet.Content), strings.ToLower(query)) {
+			snippets = append(snippets, snippet)
+		}
+	}
+	return snippets, len(snippets), nil
+}
+
+func (m *SnippetModel) Unlock(id string, viewerID string, passphrase string) error {
+	snippet, err := m.Get(id, viewerID)
+	if err != nil {
+		return err
+	}
+
+	if snippet.ID != mockProtectedSnippet.ID || passphrase != "open sesame" {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (m *SnippetModel) Burn(id string, viewerID string) (models.Snippet, error) {
+	snippet, err := m.Get(id, viewerID)
+	if err != nil {
+		return models.Snippet{}, err
+	}
+
+	if !snippet.BurnAfterReading {
+		return models.Snippet{}, models.ErrNoRecord
+	}
+	return snippet, nil
+}
+
+func (m *SnippetModel) PurgeExpired(dryRun bool) (int64, error) {
+	return 2, nil
+}
+
+func (m *SnippetModel) Fork(id string, userID string, expires time.Time) (string, error) {
+	snippet, err := m.Get(id, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if snippet.BurnAfterReading {
+		return "", models.ErrNoRecord
+	}
+	return "888888888888888888888888", nil
+}
+
+func (m *SnippetModel) ByTag(tag string, page int, pageSize int) ([]models.Snippet, int, error) {
+	if slices.Contains(mockSnippet.Tags, tag) {
+		return []models.Snippet{mockSnippet}, 1, nil
+	}
+	return nil, 0, nil
+}
+
+func (m *SnippetModel) ByIDs(ids []string, viewerID string) ([]models.Snippet, error) {
+	var snippets []models.Snippet
+	for _, id := range ids {
+		snippet, err := m.Get(id, viewerID)
+		if err == nil && !snippet.BurnAfterReading {
+			snippets = append(snippets, snippet)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *SnippetModel) TagCloud(limit int) ([]models.TagCount, error) {
+	return []models.TagCount{{Tag: "haiku", Count: 3}, {Tag: "nature", Count: 1}}, nil
+}
+
+// Mimic the ownership check of the real model for the mocked snippets
+func checkOwner(id string, userID string) error {
+	switch id {
+	case mockSnippet.ID:
+		if userID != mockSnippet.UserID {
+			return models.ErrNotOwner
+		}
+		return nil
+	case mockForeignSnippet.ID:
+		if userID != mockForeignSnippet.UserID {
+			return models.ErrNotOwner
+		}
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
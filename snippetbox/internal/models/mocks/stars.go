@@ -0,0 +1,37 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+)
+
+// The mocked authenticated user has starred mockForeignSnippet
+type StarModel struct{}
+
+func (m *StarModel) Star(userID string, snippetID string) error {
+	return nil
+}
+
+func (m *StarModel) Unstar(userID string, snippetID string) error {
+	return nil
+}
+
+func (m *StarModel) IsStarred(userID string, snippetID string) (bool, error) {
+	return userID == mockSnippet.UserID && snippetID == mockForeignSnippet.ID, nil
+}
+
+func (m *StarModel) Starred(userID string, page int, pageSize int) ([]models.Snippet, int, error) {
+	if userID == mockSnippet.UserID {
+		return []models.Snippet{mockForeignSnippet}, 1, nil
+	}
+	return nil, 0, nil
+}
+
+func (m *StarModel) MostStarred(since time.Time, limit int) ([]models.Snippet, error) {
+	return []models.Snippet{mockForeignSnippet}, nil
+}
+
+func (m *StarModel) DeleteAll(snippetID string) error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package mocks
+
+import (
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+)
+
+// The plaintext personal access tokens of the mocked authenticated user
+const (
+	mockReadWriteToken = "sbx_read-write"
+	mockReadOnlyToken  = "sbx_read"
+)
+
+// A read-write token of the mocked authenticated user
+var mockToken = models.Token{
+	ID:       "eeeeeeeeeeeeeeeeeeeeee01",
+	Name:     "CI",
+	Scope:    models.ScopeReadWrite,
+	UserID:   mockSnippet.UserID,
+	Created:  time.Now(),
+	LastUsed: time.Now(),
+}
+
+// A read-only token of the mocked authenticated user, which was never used
+var mockReadToken = models.Token{
+	ID:      "eeeeeeeeeeeeeeeeeeeeee02",
+	Name:    "Dashboard",
+	Scope:   models.ScopeRead,
+	UserID:  mockSnippet.UserID,
+	Created: time.Now(),
+}
+
+// A token of another user
+var mockForeignToken = models.Token{
+	ID:      "eeeeeeeeeeeeeeeeeeeeee03",
+	Name:    "Laptop",
+	Scope:   models.ScopeReadWrite,
+	UserID:  mockForeignSnippet.UserID,
+	Created: time.Now(),
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(userID string, name string, scope string) (string, error) {
+	return "sbx_new-token", nil
+}
+
+func (m *TokenModel) ByOwner(userID string) ([]models.Token, error) {
+	switch userID {
+	case mockToken.UserID:
+		return []models.Token{mockToken, mockReadToken}, nil
+	case mockForeignToken.UserID:
+		return []models.Token{mockForeignToken}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *TokenModel) Authenticate(plaintext string) (models.Token, error) {
+	switch plaintext {
+	case mockReadWriteToken:
+		return mockToken, nil
+	case mockReadOnlyToken:
+		return mockReadToken, nil
+	default:
+		return models.Token{}, models.ErrInvalidCredentials
+	}
+}
+
+func (m *TokenModel) Revoke(id string, userID string) error {
+	for _, token := range []models.Token{mockToken, mockReadToken, mockForeignToken} {
+		if token.ID == id {
+			if token.UserID != userID {
+				return models.ErrNotOwner
+			}
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
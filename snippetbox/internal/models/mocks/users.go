@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserModel struct{}
@@ -17,7 +18,8 @@ func (m *UserModel) Insert(name, email, password string) error {
 
 func (m *UserModel) Authenticate(email, password string) (interface{}, error) {
 	if email == "alice@example.com" && password == "pa$$word" {
-		return "111111111111111111111111", nil
+		objectID, _ := primitive.ObjectIDFromHex("111111111111111111111111")
+		return objectID, nil
 	}
 	return 0, models.ErrInvalidCredentials
 }
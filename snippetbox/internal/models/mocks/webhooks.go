@@ -0,0 +1,190 @@
+package mocks
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/models"
+)
+
+// A webhook of the mocked authenticated user
+var mockWebhook = models.Webhook{
+	ID:      "ffffffffffffffffffffff01",
+	URL:     "https://chat.example.com/hooks/snippets",
+	Secret:  "s3cret",
+	UserID:  mockSnippet.UserID,
+	Created: time.Now(),
+}
+
+// A webhook of another user
+var mockForeignWebhook = models.Webhook{
+	ID:      "ffffffffffffffffffffff02",
+	URL:     "https://bob.example.com/hooks",
+	Secret:  "hunter2",
+	UserID:  mockForeignSnippet.UserID,
+	Created: time.Now(),
+}
+
+// The delivery log of the mocked authenticated user: one delivery which was
+// sent, and one which failed for good
+var mockDeliveries = []models.Delivery{
+	{
+		ID:         "ffffffffffffffffffffff11",
+		WebhookID:  mockWebhook.ID,
+		URL:        mockWebhook.URL,
+		UserID:     mockWebhook.UserID,
+		Event:      models.EventSnippetCreated,
+		SnippetID:  mockSnippet.ID,
+		Status:     models.DeliveryDelivered,
+		Attempts:   1,
+		StatusCode: 204,
+		Created:    time.Now(),
+		Updated:    time.Now(),
+	},
+	{
+		ID:         "ffffffffffffffffffffff12",
+		WebhookID:  mockWebhook.ID,
+		URL:        mockWebhook.URL,
+		UserID:     mockWebhook.UserID,
+		Event:      models.EventSnippetUpdated,
+		SnippetID:  mockSnippet.ID,
+		Status:     models.DeliveryFailed,
+		Attempts:   8,
+		StatusCode: 502,
+		Error:      "unexpected status 502 Bad Gateway",
+		Created:    time.Now(),
+		Updated:    time.Now(),
+	},
+}
+
+// The mock keeps its queue in memory. The deliveries passed to Enqueue() can
+// be claimed like in the model, and tests can check them with Enqueued(). URL
+// replaces the URL of the webhook of the mocked authenticated user, so that
+// tests can send its deliveries to a test server
+type WebhookModel struct {
+	URL string
+
+	mu       sync.Mutex
+	enqueued []models.Delivery
+}
+
+func (m *WebhookModel) Insert(userID string, url string) (string, error) {
+	return "ffffffffffffffffffffff03", nil
+}
+
+func (m *WebhookModel) Get(id string) (models.Webhook, error) {
+	switch id {
+	case mockWebhook.ID:
+		webhook := mockWebhook
+		if m.URL != "" {
+			webhook.URL = m.URL
+		}
+		return webhook, nil
+	case mockForeignWebhook.ID:
+		return mockForeignWebhook, nil
+	default:
+		return models.Webhook{}, models.ErrNoRecord
+	}
+}
+
+func (m *WebhookModel) ByOwner(userID string) ([]models.Webhook, error) {
+	switch userID {
+	case mockWebhook.UserID:
+		return []models.Webhook{mockWebhook}, nil
+	case mockForeignWebhook.UserID:
+		return []models.Webhook{mockForeignWebhook}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *WebhookModel) Delete(id string, userID string) error {
+	webhook, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if webhook.UserID != userID {
+		return models.ErrNotOwner
+	}
+	return nil
+}
+
+func (m *WebhookModel) Enqueue(userID string, event string, snippetID string, payload []byte, due time.Time) error {
+	webhooks, err := m.ByOwner(userID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, webhook := range webhooks {
+		m.enqueued = append(m.enqueued, models.Delivery{
+			ID:          fmt.Sprintf("%024x", len(m.enqueued)+1),
+			WebhookID:   webhook.ID,
+			URL:         webhook.URL,
+			UserID:      userID,
+			Event:       event,
+			SnippetID:   snippetID,
+			Payload:     payload,
+			Status:      models.DeliveryPending,
+			NextAttempt: due,
+		})
+	}
+	return nil
+}
+
+// Return the deliveries passed to Enqueue() so far, in their current state
+func (m *WebhookModel) Enqueued() []models.Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.Delivery(nil), m.enqueued...)
+}
+
+func (m *WebhookModel) CancelPending(snippetID string, event string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enqueued = slices.DeleteFunc(m.enqueued, func(delivery models.Delivery) bool {
+		return delivery.SnippetID == snippetID && delivery.Event == event && delivery.Status == models.DeliveryPending
+	})
+	return nil
+}
+
+func (m *WebhookModel) Claim(lease time.Duration) (models.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for i, delivery := range m.enqueued {
+		if delivery.Status == models.DeliveryPending && !delivery.NextAttempt.After(now) {
+			m.enqueued[i].NextAttempt = now.Add(lease)
+			return m.enqueued[i], nil
+		}
+	}
+	return models.Delivery{}, models.ErrNoRecord
+}
+
+func (m *WebhookModel) UpdateDelivery(delivery models.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.enqueued {
+		if m.enqueued[i].ID == delivery.ID {
+			m.enqueued[i] = delivery
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *WebhookModel) Deliveries(userID string, page int, pageSize int) ([]models.Delivery, int, error) {
+	if userID == mockWebhook.UserID {
+		return mockDeliveries, len(mockDeliveries), nil
+	}
+	return nil, 0, nil
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RevisionModelInterface interface {
+	Insert(snippet Snippet, userID string) (int, error)
+	Get(snippetID string, number int) (Revision, error)
+	All(snippetID string) ([]Revision, error)
+	DeleteAll(snippetID string) error
+}
+
+// Define a Revision type to hold one version of a snippet. Revisions are
+// numbered from 1 for every snippet
+type Revision struct {
+	ID        string `bson:"_id,omitempty"`
+	SnippetID string `bson:"snippet_id"`
+	Number    int
+	Title     string
+	Content   string
+	Language  string
+	Filename  string `bson:"filename,omitempty"`
+	Files     []File `bson:"files,omitempty"`
+	// ID of the user who saved the revision and their name
+	UserID  string `bson:"user_id"`
+	Author  string
+	Created time.Time
+	// The expiry time of the snippet, zero if it never expires
+	Expires time.Time `bson:"expires,omitempty"`
+}
+
+// Define a RevisionModel type which wraps a database connection pool
+type RevisionModel struct {
+	DB *mongo.Database
+}
+
+// This will store the title, content, language and files of the snippet as its
+// next revision, saved by the given user, and return the number of the
+// revision. The unique index on the snippet id and number (see EnsureIndexes)
+// makes one of two concurrent inserts fail instead of sharing a number.
+// Revisions hold the content of the snippet, so they must not outlive it:
+// all the revisions of the snippet get its expiry time, and MongoDB deletes
+// them with the snippet through the TTL index
+func (m *RevisionModel) Insert(snippet Snippet, userID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snippetID, err := primitive.ObjectIDFromHex(snippet.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	authorID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	collection := m.DB.Collection("snippet_revisions")
+
+	// Find the number of the latest revision
+	var latest struct {
+		Number int
+	}
+
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "number", Value: -1}}).
+		SetProjection(bson.D{{Key: "number", Value: 1}})
+
+	err = collection.FindOne(ctx, bson.D{{Key: "snippet_id", Value: snippetID}}, opts).Decode(&latest)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+
+	doc := bson.D{
+		{Key: "snippet_id", Value: snippetID},
+		{Key: "number", Value: latest.Number + 1},
+		{Key: "title", Value: snippet.Title},
+		{Key: "content", Value: snippet.Content},
+		{Key: "language", Value: snippet.Language},
+		{Key: "user_id", Value: authorID},
+		{Key: "created", Value: time.Now()},
+	}
+	doc = append(doc, fileFields(snippet.Filename, snippet.Files)...)
+
+	// Like for the snippets, no expiry time means it never expires
+	expires := bson.D{{Key: "$unset", Value: bson.D{{Key: "expires", Value: ""}}}}
+	if !snippet.Expires.IsZero() {
+		doc = append(doc, bson.E{Key: "expires", Value: snippet.Expires})
+		expires = bson.D{{Key: "$set", Value: bson.D{{Key: "expires", Value: snippet.Expires}}}}
+	}
+
+	_, err = collection.InsertOne(ctx, doc)
+	if err != nil {
+		return 0, err
+	}
+
+	// The expiry time of the snippet may have changed since the previous
+	// revisions were saved
+	_, err = collection.UpdateMany(ctx, bson.D{{Key: "snippet_id", Value: snippetID}}, expires)
+	if err != nil {
+		return 0, err
+	}
+
+	return latest.Number + 1, nil
+}
+
+// This will return one revision of the snippet
+func (m *RevisionModel) Get(snippetID string, number int) (Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any snippet
+	objID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return Revision{}, ErrNoRecord
+	}
+
+	filter := bson.D{
+		{Key: "snippet_id", Value: objID},
+		{Key: "number", Value: number},
+	}
+
+	revisions, err := m.find(ctx, filter)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	if len(revisions) == 0 {
+		return Revision{}, ErrNoRecord
+	}
+
+	return revisions[0], nil
+}
+
+// This will return all the revisions of the snippet, newest first
+func (m *RevisionModel) All(snippetID string) ([]Revision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any snippet
+	objID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return nil, ErrNoRecord
+	}
+
+	return m.find(ctx, bson.D{{Key: "snippet_id", Value: objID}})
+}
+
+// This will remove all the revisions of the snippet
+func (m *RevisionModel) DeleteAll(snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("snippet_revisions").DeleteMany(ctx, bson.D{{Key: "snippet_id", Value: objID}})
+	return err
+}
+
+// Return the revisions matching filter, newest first, with the name of the
+// user who saved each of them as the Author
+func (m *RevisionModel) find(ctx context.Context, filter bson.D) ([]Revision, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "number", Value: -1}}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "users"},
+			{Key: "localField", Value: "user_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "owner"},
+		}}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "author", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$owner.name", 0}}}},
+		}}},
+		{{Key: "$project", Value: bson.D{{Key: "owner", Value: 0}}}},
+	}
+
+	cursor, err := m.DB.Collection("snippet_revisions").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var revisions []Revision
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
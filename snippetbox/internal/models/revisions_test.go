@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The revisions hold the content of the snippet, so they must expire with it,
+// also when its expiry time changes
+func TestRevisionModelInsertExpires(t *testing.T) {
+	// Skip the test if the "-short" flag is provided when running the test
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	err := EnsureIndexes(db)
+	assert.NilError(t, err)
+
+	m := RevisionModel{db}
+
+	snippet := Snippet{
+		ID:      primitive.NewObjectID().Hex(),
+		Title:   "An old silent pond",
+		Content: "An old silent pond...",
+		Expires: time.Now().Add(time.Hour).Truncate(time.Millisecond),
+	}
+	userID := primitive.NewObjectID().Hex()
+
+	// Check the expiry time of all the revisions of the snippet
+	checkExpires := func(want time.Time) {
+		t.Helper()
+
+		revisions, err := m.All(snippet.ID)
+		assert.NilError(t, err)
+
+		for _, revision := range revisions {
+			assert.Equal(t, revision.Expires.Equal(want), true)
+		}
+	}
+
+	_, err = m.Insert(snippet, userID)
+	assert.NilError(t, err)
+	checkExpires(snippet.Expires)
+
+	// A later expiry time is given to the previous revisions too
+	snippet.Expires = snippet.Expires.Add(24 * time.Hour)
+	number, err := m.Insert(snippet, userID)
+	assert.NilError(t, err)
+	assert.Equal(t, number, 2)
+	checkExpires(snippet.Expires)
+
+	// And so is no expiry at all
+	snippet.Expires = time.Time{}
+	_, err = m.Insert(snippet, userID)
+	assert.NilError(t, err)
+	checkExpires(time.Time{})
+
+	// MongoDB deletes the revisions through the TTL index
+	cursor, err := db.Collection("snippet_revisions").Indexes().List(context.TODO())
+	assert.NilError(t, err)
+
+	var indexes []bson.M
+	err = cursor.All(context.TODO(), &indexes)
+	assert.NilError(t, err)
+
+	found := false
+	for _, index := range indexes {
+		if index["name"] == "revision_expires_ttl_index" {
+			found = true
+			assert.Equal(t, index["expireAfterSeconds"], any(int32(0)))
+		}
+	}
+	assert.Equal(t, found, true)
+}
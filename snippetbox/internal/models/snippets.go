@@ -2,18 +2,80 @@ package models
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (interface{}, error)
-	Get(id string) (Snippet, error)
+	Insert(snippet Snippet, passphrase string) (interface{}, error)
+	Get(id string, viewerID string) (Snippet, error)
 	Latest() ([]Snippet, error)
+	Update(snippet Snippet) error
+	Delete(id string, userID string) error
+	ByOwner(userID string, page int, pageSize int, sort string, includeExpired bool) ([]Snippet, int, error)
+	Browse(filter SnippetFilter) ([]Snippet, string, error)
+	Search(query string, page int, pageSize int) ([]Snippet, int, error)
+	Unlock(id string, viewerID string, passphrase string) error
+	Burn(id string, viewerID string) (Snippet, error)
+	PurgeExpired(dryRun bool) (int64, error)
+	Fork(id string, userID string, expires time.Time) (string, error)
+	ByTag(tag string, page int, pageSize int) ([]Snippet, int, error)
+	TagCloud(limit int) ([]TagCount, error)
+	ByIDs(ids []string, viewerID string) ([]Snippet, error)
+}
+
+// Define a TagCount type to hold a tag and the number of snippets which have it
+type TagCount struct {
+	Tag   string `bson:"_id"`
+	Count int
+}
+
+// Define a SnippetFilter type to hold the filters for browsing snippets. Zero
+// values mean that the corresponding filter isn't applied
+type SnippetFilter struct {
+	// ID of the user who created the snippets
+	Author string
+	// Creation time range, From is inclusive and To is exclusive
+	From time.Time
+	To   time.Time
+	// Position after which the page starts, as returned by Browse()
+	Cursor string
+	// Maximum number of snippets on the page
+	Limit int
+}
+
+// Visibility levels of snippets
+const (
+	// Listed on the public pages and viewable by everyone
+	VisibilityPublic = "public"
+	// Not listed anywhere, but viewable by everyone who knows the link
+	VisibilityUnlisted = "unlisted"
+	// Viewable only by the owner of the snippet
+	VisibilityPrivate = "private"
+)
+
+// All the visibility levels of snippets
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// Fields which the snippets of a user can be sorted by
+var SnippetSortFields = []string{"created", "expires", "title"}
+
+// Define a File type to hold one of the additional files of a snippet
+type File struct {
+	Name     string
+	Content  string
+	Language string
 }
 
 // Define a Snippet type to hold the data for an individual snippet
@@ -21,8 +83,43 @@ type Snippet struct {
 	ID      string `bson:"_id,omitempty"`
 	Title   string
 	Content string
-	Created time.Time
-	Expires time.Time
+	// Language the content is highlighted in
+	Language string
+	// Name of the file the content belongs to, if the author gave one
+	Filename string `bson:"filename,omitempty"`
+	// The files of the snippet besides the main one (Content)
+	Files []File `bson:"files,omitempty"`
+	// Who can see the snippet, one of the Visibilities
+	Visibility string
+	Created    time.Time
+	Expires    time.Time
+	// ID of the user who created the snippet
+	UserID string `bson:"user_id"`
+	// Name of the user who created the snippet. It isn't stored with the
+	// snippet, but joined from the "users" collection when reading
+	Author string
+	// bcrypt hash of the passphrase needed to see the content, if any
+	HashedPassphrase []byte `bson:"hashed_passphrase,omitempty"`
+	// The snippet is deleted as soon as it has been read once
+	BurnAfterReading bool `bson:"burn_after_reading,omitempty"`
+	// ID of the snippet this one was forked from, if any
+	ForkedFrom string `bson:"forked_from,omitempty"`
+	// Number of times the snippet has been forked
+	Forks int `bson:"forks,omitempty"`
+	// Slugs the snippet is tagged with
+	Tags []string `bson:"tags,omitempty"`
+	// Number of users who starred the snippet
+	Stars int `bson:"stars,omitempty"`
+}
+
+// Returns true if the snippet has already expired
+func (s Snippet) IsExpired() bool {
+	return !s.Expires.IsZero() && !s.Expires.After(time.Now())
+}
+
+// Returns true if a passphrase is needed to see the content of the snippet
+func (s Snippet) IsProtected() bool {
+	return len(s.HashedPassphrase) > 0
 }
 
 // Define a SnippetModel type which wraps a mongo.Client connection pool
@@ -30,18 +127,53 @@ type SnippetModel struct {
 	DB *mongo.Database
 }
 
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (interface{}, error) {
+// This will insert a new snippet into the database. The title, content,
+// language, visibility, expiry time, owner (UserID) and burn after reading flag
+// are taken from the snippet. If passphrase isn't empty, it will be needed to
+// see the content
+func (m *SnippetModel) Insert(snippet Snippet, passphrase string) (interface{}, error) {
 	// Create context for operation
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Transform owner id to ObjectID
+	ownerID, err := primitive.ObjectIDFromHex(snippet.UserID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Prepare document for insert
 	doc := bson.D{
-		{Key: "title", Value: title},
-		{Key: "content", Value: content},
+		{Key: "title", Value: snippet.Title},
+		{Key: "content", Value: snippet.Content},
+		{Key: "language", Value: snippet.Language},
+		{Key: "visibility", Value: snippet.Visibility},
 		{Key: "created", Value: time.Now()},
-		{Key: "expires", Value: time.Now().Add(time.Duration(expires) * time.Hour * 24)},
+		{Key: "user_id", Value: ownerID},
+	}
+
+	// Snippets which never expire have no expiry time at all
+	if !snippet.Expires.IsZero() {
+		doc = append(doc, bson.E{Key: "expires", Value: snippet.Expires})
+	}
+
+	doc = append(doc, fileFields(snippet.Filename, snippet.Files)...)
+
+	if len(snippet.Tags) > 0 {
+		doc = append(doc, bson.E{Key: "tags", Value: snippet.Tags})
+	}
+
+	if snippet.BurnAfterReading {
+		doc = append(doc, bson.E{Key: "burn_after_reading", Value: true})
+	}
+
+	// Store only a bcrypt hash of the passphrase, the same way as passwords of users
+	if passphrase != "" {
+		hashedPassphrase, err := bcrypt.GenerateFromPassword([]byte(passphrase), 12)
+		if err != nil {
+			return nil, err
+		}
+		doc = append(doc, bson.E{Key: "hashed_passphrase", Value: string(hashedPassphrase)})
 	}
 
 	// Get collection for insert operation
@@ -58,37 +190,58 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (interf
 
 }
 
-// This will return a specific snippet based on its id
-func (m *SnippetModel) Get(id string) (Snippet, error) {
+// This will return a specific snippet based on its id. Private snippets are
+// only returned to their owner, so viewerID is the ID of the user who wants
+// to see the snippet (or empty for anonymous users)
+func (m *SnippetModel) Get(id string, viewerID string) (Snippet, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Create empty Snippet for saving results
-	var s Snippet
-
-	// Transform id to ObjectID
+	// An invalid id can't match any snippet
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return Snippet{}, err
+		return Snippet{}, ErrNoRecord
+	}
+
+	// Private snippets are visible only to their owner
+	visible := bson.A{bson.D{{Key: "visibility", Value: bson.D{{Key: "$ne", Value: VisibilityPrivate}}}}}
+	if viewerID != "" {
+		viewerObjID, err := primitive.ObjectIDFromHex(viewerID)
+		if err != nil {
+			return Snippet{}, err
+		}
+		visible = append(visible, bson.D{{Key: "user_id", Value: viewerObjID}})
 	}
 
 	// Create request for searching document
 	filter := bson.D{
 		{Key: "_id", Value: objID},
-		{Key: "expires", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+		{Key: "$and", Value: bson.A{
+			notExpiredFilter(),
+			bson.D{{Key: "$or", Value: visible}},
+		}},
 	}
 
 	// Execute request for the collection and find one document
-	err = m.DB.Collection("snippets").FindOne(ctx, filter).Decode(&s)
+	snippets, err := m.find(ctx, filter, nil, 0, 1)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return Snippet{}, ErrNoRecord
-		}
 		return Snippet{}, err
 	}
 
+	if len(snippets) == 0 {
+		// Tell burned snippets apart from the ones which never existed
+		count, err := m.DB.Collection("burned_snippets").CountDocuments(ctx, bson.D{{Key: "_id", Value: objID}})
+		if err != nil {
+			return Snippet{}, err
+		}
+		if count > 0 {
+			return Snippet{}, ErrBurned
+		}
+		return Snippet{}, ErrNoRecord
+	}
+
 	// Return result
-	return s, nil
+	return snippets[0], nil
 }
 
 // This will return the 10 most recently created snippets
@@ -96,19 +249,763 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Create empty array for snippets
+	// Search only not expired public document
+	filter := append(notExpiredFilter(), publicFilter...)
+
+	// Get last 10 documents ordered by the creation time
+	return m.find(ctx, filter, bson.D{{Key: "created", Value: -1}}, 0, 10)
+}
+
+// Return the fields which store the file name of the main file and the other
+// files of a snippet. Empty values aren't stored
+func fileFields(filename string, files []File) bson.D {
+	var fields bson.D
+
+	if filename != "" {
+		fields = append(fields, bson.E{Key: "filename", Value: filename})
+	}
+
+	if len(files) > 0 {
+		docs := make(bson.A, len(files))
+		for i, file := range files {
+			docs[i] = bson.D{
+				{Key: "name", Value: file.Name},
+				{Key: "content", Value: file.Content},
+				{Key: "language", Value: file.Language},
+			}
+		}
+		fields = append(fields, bson.E{Key: "files", Value: docs})
+	}
+
+	return fields
+}
+
+// Matches the snippets which haven't expired yet, including the ones which
+// never expire (they have no expiry time)
+func notExpiredFilter() bson.D {
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "expires", Value: bson.D{{Key: "$gt", Value: time.Now()}}}},
+		bson.D{{Key: "expires", Value: bson.D{{Key: "$exists", Value: false}}}},
+	}}}
+}
+
+// Matches the snippets which can be listed on the public pages. Snippets
+// created before visibility levels were added have no visibility and are
+// public. Burn after reading snippets are never listed, so that they aren't
+// burned by a random visitor
+var publicFilter = bson.D{
+	{Key: "visibility", Value: bson.D{{Key: "$in", Value: bson.A{VisibilityPublic, nil}}}},
+	{Key: "burn_after_reading", Value: bson.D{{Key: "$ne", Value: true}}},
+}
+
+// Return the aggregation stages which join the name of the owner (user_id) of
+// each document as the "author" field
+func authorStages() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "users"},
+			{Key: "localField", Value: "user_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "owner"},
+		}}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "author", Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$owner.name", 0}}}},
+		}}},
+		{{Key: "$project", Value: bson.D{{Key: "owner", Value: 0}}}},
+	}
+}
+
+// This will return one page of the snippets owned by a user, sorted by one of
+// the SnippetSortFields, together with the total number of matching snippets.
+// Expired snippets are only included if includeExpired is true
+func (m *SnippetModel) ByOwner(userID string, page int, pageSize int, sort string, includeExpired bool) ([]Snippet, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := bson.D{{Key: "user_id", Value: ownerID}}
+	if !includeExpired {
+		filter = append(filter, notExpiredFilter()...)
+	}
+
+	// Newest snippets go first, while titles and expiry times are sorted in
+	// ascending order. The id keeps the order stable between pages
+	var order bson.D
+	switch sort {
+	case "title":
+		order = bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}}
+	case "expires":
+		order = bson.D{{Key: neverExpiresField, Value: 1}, {Key: "expires", Value: 1}, {Key: "_id", Value: 1}}
+	default:
+		order = bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}}
+	}
+
+	// Count all the matching snippets for the pagination
+	total, err := m.DB.Collection("snippets").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	snippets, err := m.find(ctx, filter, order, int64((page-1)*pageSize), int64(pageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, int(total), nil
+}
+
+// This will replace the title, content, language, visibility and expiry time of
+// the snippet with the ID of the given one. Only the owner of the snippet
+// (UserID) is allowed to change it
+func (m *SnippetModel) Update(snippet Snippet) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Make sure the snippet exists and belongs to the user
+	filter, err := m.ownerFilter(ctx, snippet.ID, snippet.UserID)
+	if err != nil {
+		return err
+	}
+
+	// Prepare the fields for update
+	fields := bson.D{
+		{Key: "title", Value: snippet.Title},
+		{Key: "content", Value: snippet.Content},
+		{Key: "language", Value: snippet.Language},
+		{Key: "visibility", Value: snippet.Visibility},
+	}
+	fields = append(fields, fileFields(snippet.Filename, snippet.Files)...)
+
+	// Remove the expiry time if the snippet shouldn't expire anymore, and
+	// the file name and files if there are none anymore
+	unset := bson.D{}
+	if snippet.Expires.IsZero() {
+		unset = append(unset, bson.E{Key: "expires", Value: ""})
+	} else {
+		fields = append(fields, bson.E{Key: "expires", Value: snippet.Expires})
+	}
+	if snippet.Filename == "" {
+		unset = append(unset, bson.E{Key: "filename", Value: ""})
+	}
+	if len(snippet.Files) == 0 {
+		unset = append(unset, bson.E{Key: "files", Value: ""})
+	}
+	if len(snippet.Tags) == 0 {
+		unset = append(unset, bson.E{Key: "tags", Value: ""})
+	} else {
+		fields = append(fields, bson.E{Key: "tags", Value: snippet.Tags})
+	}
+
+	update := bson.D{{Key: "$set", Value: fields}}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+
+	result, err := m.DB.Collection("snippets").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	// The snippet was removed between the check and the update
+	if result.MatchedCount == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// This will remove a snippet. Only the owner of the snippet is allowed to delete it
+func (m *SnippetModel) Delete(id string, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Make sure the snippet exists and belongs to the user
+	filter, err := m.ownerFilter(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.DB.Collection("snippets").DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	// The snippet was removed between the check and the delete
+	if result.DeletedCount == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Check that a not expired snippet with the given id exists and is owned by the
+// user. It returns ErrNoRecord or ErrNotOwner if not, and otherwise a filter
+// which matches only that snippet of that user
+func (m *SnippetModel) ownerFilter(ctx context.Context, id string, userID string) (bson.D, error) {
+	// An invalid id can't match any snippet
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNoRecord
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := append(bson.D{{Key: "_id", Value: objID}}, notExpiredFilter()...)
+
+	// Read only the owner of the snippet
+	var result struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+
+	opts := options.FindOne().SetProjection(bson.D{{Key: "user_id", Value: 1}})
+
+	err = m.DB.Collection("snippets").FindOne(ctx, filter, opts).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	if result.UserID != ownerID {
+		return nil, ErrNotOwner
+	}
+
+	return append(filter, bson.E{Key: "user_id", Value: ownerID}), nil
+}
+
+// This will return a page of not expired public snippets matching the filter, newest
+// first, and a cursor which points to the next page. The cursor is empty on the
+// last page. Paging is keyed on the creation time and id of the last snippet
+// on the page, so pages stay stable while new snippets are being added
+func (m *SnippetModel) Browse(filter SnippetFilter) ([]Snippet, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conditions := bson.A{
+		notExpiredFilter(),
+		publicFilter,
+	}
+
+	if filter.Author != "" {
+		authorID, err := primitive.ObjectIDFromHex(filter.Author)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, bson.D{{Key: "user_id", Value: authorID}})
+	}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, bson.D{{Key: "created", Value: bson.D{{Key: "$gte", Value: filter.From}}}})
+	}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, bson.D{{Key: "created", Value: bson.D{{Key: "$lt", Value: filter.To}}}})
+	}
+
+	// Start after the last snippet of the previous page
+	if filter.Cursor != "" {
+		created, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "created", Value: bson.D{{Key: "$lt", Value: created}}}},
+			bson.D{
+				{Key: "created", Value: created},
+				{Key: "_id", Value: bson.D{{Key: "$lt", Value: id}}},
+			},
+		}}})
+	}
+
+	// Read one snippet more than requested to know if there is a next page
+	order := bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}}
+	snippets, err := m.find(ctx, bson.D{{Key: "$and", Value: conditions}}, order, 0, int64(filter.Limit+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(snippets) <= filter.Limit {
+		return snippets, "", nil
+	}
+
+	snippets = snippets[:filter.Limit]
+	last := snippets[len(snippets)-1]
+
+	return snippets, encodeCursor(last.Created, last.ID), nil
+}
+
+// This will return one page of not expired public snippets whose title or content
+// match the query, best matches first, together with the total number of
+// matching snippets. The query uses the MongoDB text search syntax. Snippets
+// protected by a passphrase aren't searched, so their content can't be guessed
+func (m *SnippetModel) Search(query string, page int, pageSize int) ([]Snippet, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.D{
+		{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}},
+	}
+	filter = append(filter, notExpiredFilter()...)
+	filter = append(filter, publicFilter...)
+	filter = append(filter, bson.E{Key: "hashed_passphrase", Value: bson.D{{Key: "$exists", Value: false}}})
+
+	// Count all the matching snippets for the pagination
+	total, err := m.DB.Collection("snippets").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	// Rank the snippets by the text score
+	order := bson.D{
+		{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}},
+		{Key: "created", Value: -1},
+	}
+
+	snippets, err := m.find(ctx, filter, order, int64((page-1)*pageSize), int64(pageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, int(total), nil
+}
+
+// Check the passphrase of a snippet which the viewer is allowed to see. It
+// returns ErrInvalidCredentials if the passphrase doesn't match, or if the
+// snippet isn't protected by a passphrase at all
+func (m *SnippetModel) Unlock(id string, viewerID string, passphrase string) error {
+	snippet, err := m.Get(id, viewerID)
+	if err != nil {
+		return err
+	}
+
+	if !snippet.IsProtected() {
+		return ErrInvalidCredentials
+	}
+
+	err = bcrypt.CompareHashAndPassword(snippet.HashedPassphrase, []byte(passphrase))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	return nil
+}
+
+// This will return one page of not expired public snippets with the tag, newest
+// first, together with the total number of snippets with the tag
+func (m *SnippetModel) ByTag(tag string, page int, pageSize int) ([]Snippet, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Matching a single value against the tags array finds the snippets which
+	// have it among their tags
+	filter := bson.D{{Key: "tags", Value: tag}}
+	filter = append(filter, notExpiredFilter()...)
+	filter = append(filter, publicFilter...)
+	filter = append(filter, bson.E{Key: "hashed_passphrase", Value: bson.D{{Key: "$exists", Value: false}}})
+
+	// Count all the matching snippets for the pagination
+	total, err := m.DB.Collection("snippets").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	order := bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}}
+
+	snippets, err := m.find(ctx, filter, order, int64((page-1)*pageSize), int64(pageSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, int(total), nil
+}
+
+// This will return the snippets with the given ids, in the same order. Like
+// Get() it leaves out snippets which have expired or which are private to
+// another user than the viewer. Burn after reading snippets are left out too,
+// so that they aren't burned by someone following a list
+func (m *SnippetModel) ByIDs(ids []string, viewerID string) ([]Snippet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objIDs := make(bson.A, 0, len(ids))
+	for _, id := range ids {
+		// An invalid id can't match any snippet, so it is left out too
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			continue
+		}
+		objIDs = append(objIDs, objID)
+	}
+
+	visible := bson.A{bson.D{{Key: "visibility", Value: bson.D{{Key: "$ne", Value: VisibilityPrivate}}}}}
+	if viewerID != "" {
+		viewerObjID, err := primitive.ObjectIDFromHex(viewerID)
+		if err != nil {
+			return nil, err
+		}
+		visible = append(visible, bson.D{{Key: "user_id", Value: viewerObjID}})
+	}
+
+	filter := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$in", Value: objIDs}}},
+		{Key: "burn_after_reading", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "$and", Value: bson.A{
+			notExpiredFilter(),
+			bson.D{{Key: "$or", Value: visible}},
+		}},
+	}
+
+	found, err := m.find(ctx, filter, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Put the snippets in the order of the ids
+	byID := make(map[string]Snippet, len(found))
+	for _, snippet := range found {
+		byID[snippet.ID] = snippet
+	}
+
 	var snippets []Snippet
+	for _, id := range ids {
+		if snippet, ok := byID[id]; ok {
+			snippets = append(snippets, snippet)
+		}
+	}
+
+	return snippets, nil
+}
+
+// This will return the limit most used tags of the not expired public
+// snippets, with the number of snippets for each of them, in alphabetical order
+func (m *SnippetModel) TagCloud(limit int) ([]TagCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	// Search only not expired document
+	filter := append(notExpiredFilter(), publicFilter...)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$tags"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := m.DB.Collection("snippets").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tags []TagCount
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// How long Get tells a burned snippet apart from one which never existed
+const burnedTombstoneLifetime = 30 * 24 * time.Hour
+
+// This will atomically delete a burn after reading snippet which the viewer is
+// allowed to see, and return it. Only one caller gets the snippet, everyone
+// else (including later callers of Get, for burnedTombstoneLifetime) gets
+// ErrBurned
+func (m *SnippetModel) Burn(id string, viewerID string) (Snippet, error) {
+	snippet, err := m.Get(id, viewerID)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	if !snippet.BurnAfterReading {
+		return Snippet{}, ErrNoRecord
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any snippet
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Snippet{}, ErrNoRecord
+	}
+
+	// Find and delete the snippet in one operation, so two concurrent viewers
+	// can't both read it
+	var burned Snippet
 	filter := bson.D{
-		{Key: "expires", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+		{Key: "_id", Value: objID},
+		{Key: "burn_after_reading", Value: true},
 	}
 
-	// Get last 10 documents ordered by the creation time
-	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}}).SetLimit(10)
+	err = m.DB.Collection("snippets").FindOneAndDelete(ctx, filter).Decode(&burned)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Snippet{}, ErrBurned
+		}
+		return Snippet{}, err
+	}
+
+	// Leave a tombstone, so later visitors learn that the snippet is gone. It
+	// is deleted after burnedTombstoneLifetime by a TTL index
+	_, err = m.DB.Collection("burned_snippets").InsertOne(ctx, bson.D{
+		{Key: "_id", Value: objID},
+		{Key: "burned", Value: time.Now()},
+	})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return Snippet{}, err
+	}
+
+	// The author isn't stored with the snippet
+	burned.Author = snippet.Author
+
+	return burned, nil
+}
+
+// This will copy a snippet which the user is allowed to see into a new
+// snippet owned by the user, which expires at the given time (or never, if it
+// is zero), and return the ID of the copy. The copy keeps the visibility and
+// the passphrase of the original, and refers to it in ForkedFrom. Expired and
+// burn after reading snippets can't be forked
+func (m *SnippetModel) Fork(id string, userID string, expires time.Time) (string, error) {
+	// Get() returns only snippets which haven't expired and are visible to the user
+	source, err := m.Get(id, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if source.BurnAfterReading {
+		return "", ErrNoRecord
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sourceID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return "", err
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", err
+	}
+
+	// Snippets created before visibility levels were added are public
+	visibility := source.Visibility
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+
+	doc := bson.D{
+		{Key: "title", Value: source.Title},
+		{Key: "content", Value: source.Content},
+		{Key: "language", Value: source.Language},
+		{Key: "visibility", Value: visibility},
+		{Key: "created", Value: time.Now()},
+		{Key: "user_id", Value: ownerID},
+		{Key: "forked_from", Value: sourceID},
+	}
+	doc = append(doc, fileFields(source.Filename, source.Files)...)
+
+	if len(source.Tags) > 0 {
+		doc = append(doc, bson.E{Key: "tags", Value: source.Tags})
+	}
+
+	if !expires.IsZero() {
+		doc = append(doc, bson.E{Key: "expires", Value: expires})
+	}
+
+	// Whoever could read the original needed its passphrase, which protects
+	// the copy as well
+	if source.IsProtected() {
+		doc = append(doc, bson.E{Key: "hashed_passphrase", Value: string(source.HashedPassphrase)})
+	}
+
+	collection := m.DB.Collection("snippets")
+
+	result, err := collection.InsertOne(ctx, doc)
+	if err != nil {
+		return "", err
+	}
+
+	// Count the fork on the original
+	_, err = collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: sourceID}}, bson.D{{Key: "$inc", Value: bson.D{{Key: "forks", Value: 1}}}})
+	if err != nil {
+		return "", err
+	}
+
+	forkID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("models: unexpected id type %T", result.InsertedID)
+	}
+
+	return forkID.Hex(), nil
+}
+
+// This will delete all the expired snippets and return how many were deleted.
+// With dryRun the snippets are only counted. Snippets which never expire have
+// no expiry time and aren't matched. MongoDB removes expired snippets by
+// itself through the TTL index (see EnsureIndexes), but it does so only about
+// once a minute and not at all on some deployments. The data which is of no
+// use without the snippets is deleted with them: their revisions, stars and
+// comments, and the references to them in collections
+func (m *SnippetModel) PurgeExpired(dryRun bool) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: "expires", Value: bson.D{{Key: "$lte", Value: time.Now()}}}}
+
+	collection := m.DB.Collection("snippets")
+
+	if dryRun {
+		return collection.CountDocuments(ctx, filter)
+	}
+
+	// Find the ids of the expired snippets first, to delete their data too
+	opts := options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err = cursor.All(ctx, &expired)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	ids := make(bson.A, 0, len(expired))
+	for _, snippet := range expired {
+		ids = append(ids, snippet.ID)
+	}
+
+	result, err := collection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return 0, err
+	}
+
+	bySnippet := bson.D{{Key: "snippet_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	for _, name := range []string{"snippet_revisions", "stars", "comments"} {
+		_, err = m.DB.Collection(name).DeleteMany(ctx, bySnippet)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = m.DB.Collection("collections").UpdateMany(ctx,
+		bson.D{{Key: "snippet_ids", Value: bson.D{{Key: "$in", Value: ids}}}},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "snippet_ids", Value: bson.D{{Key: "$in", Value: ids}}}}}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// Encode the creation time and id of a snippet into an opaque cursor string
+func encodeCursor(created time.Time, id string) string {
+	raw := fmt.Sprintf("%d:%s", created.UnixMilli(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Decode a cursor string created by encodeCursor()
+func decodeCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	millis, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	return time.UnixMilli(ms), objID, nil
+}
+
+// The name of the field computed by find() for sorting by the expiry time
+const neverExpiresField = "never_expires"
+
+// Return the snippets matching filter, ordered by sort, skipping the first skip
+// documents and limited to limit documents (a nil sort or zero limit leaves the
+// result unordered or unlimited). Every snippet gets its Author populated from
+// the "users" collection
+func (m *SnippetModel) find(ctx context.Context, filter bson.D, sort bson.D, skip int64, limit int64) ([]Snippet, error) {
+	// Create empty array for snippets
+	var snippets []Snippet
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter}}}
+
+	// Snippets which never expire have no expiry time, so they would be sorted
+	// before all the others. A computed field lets them be sorted last
+	if slices.ContainsFunc(sort, func(e bson.E) bool { return e.Key == neverExpiresField }) {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: neverExpiresField, Value: bson.D{{Key: "$not", Value: bson.A{"$expires"}}}},
+		}}})
+	}
+
+	if sort != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	}
+	if skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: skip}})
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	pipeline = append(pipeline, authorStages()...)
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.D{{Key: neverExpiresField, Value: 0}}}})
 
 	// Execute request
-	cursor, err := m.DB.Collection("snippets").Find(ctx, filter, opts)
+	cursor, err := m.DB.Collection("snippets").Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
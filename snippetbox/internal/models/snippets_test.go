@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sotnikea/Go_Learn/tree/main/snippetbox/internal/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSnippetModelPurgeExpired(t *testing.T) {
+	// Skip the test if the "-short" flag is provided when running the test
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	// Add an expired snippet, one which expires later and one which never expires
+	now := time.Now()
+	_, err := db.Collection("snippets").InsertMany(context.TODO(), []interface{}{
+		bson.D{{Key: "title", Value: "Expired"}, {Key: "created", Value: now.Add(-2 * time.Hour)}, {Key: "expires", Value: now.Add(-time.Hour)}},
+		bson.D{{Key: "title", Value: "Expires later"}, {Key: "created", Value: now}, {Key: "expires", Value: now.Add(time.Hour)}},
+		bson.D{{Key: "title", Value: "Never expires"}, {Key: "created", Value: now}},
+	})
+	assert.NilError(t, err)
+
+	m := SnippetModel{db}
+
+	// A dry run only counts the expired snippet
+	count, err := m.PurgeExpired(true)
+	assert.NilError(t, err)
+	assert.Equal(t, count, int64(1))
+
+	remaining, err := db.Collection("snippets").CountDocuments(context.TODO(), bson.D{{Key: "title", Value: "Expired"}})
+	assert.NilError(t, err)
+	assert.Equal(t, remaining, int64(1))
+
+	// A real run deletes it and leaves the other ones alone
+	count, err = m.PurgeExpired(false)
+	assert.NilError(t, err)
+	assert.Equal(t, count, int64(1))
+
+	for _, title := range []string{"Expired", "Expires later", "Never expires"} {
+		want := int64(1)
+		if title == "Expired" {
+			want = 0
+		}
+
+		remaining, err := db.Collection("snippets").CountDocuments(context.TODO(), bson.D{{Key: "title", Value: title}})
+		assert.NilError(t, err)
+		assert.Equal(t, remaining, want)
+	}
+
+	// Create the TTL index, like the application does at startup. It is created
+	// last, so that MongoDB can't delete the expired snippet before the purge
+	err = EnsureIndexes(db)
+	assert.NilError(t, err)
+
+	cursor, err := db.Collection("snippets").Indexes().List(context.TODO())
+	assert.NilError(t, err)
+
+	var indexes []bson.M
+	err = cursor.All(context.TODO(), &indexes)
+	assert.NilError(t, err)
+
+	found := false
+	for _, index := range indexes {
+		if index["name"] == "expires_ttl_index" {
+			found = true
+			assert.Equal(t, index["expireAfterSeconds"], any(int32(0)))
+		}
+	}
+	assert.Equal(t, found, true)
+}
+
+func TestSnippetModelSearch(t *testing.T) {
+	// Skip the test if the "-short" flag is provided when running the test
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	err := EnsureIndexes(db)
+	assert.NilError(t, err)
+
+	// Add a public snippet and one protected by a passphrase, with the same
+	// words in their content
+	now := time.Now()
+	_, err = db.Collection("snippets").InsertMany(context.TODO(), []interface{}{
+		bson.D{{Key: "title", Value: "Open"}, {Key: "content", Value: "Lightning flash"}, {Key: "visibility", Value: VisibilityPublic}, {Key: "created", Value: now}},
+		bson.D{{Key: "title", Value: "Protected"}, {Key: "content", Value: "Lightning flash"}, {Key: "visibility", Value: VisibilityPublic}, {Key: "created", Value: now}, {Key: "hashed_passphrase", Value: "$2a$12$open.sesame"}},
+	})
+	assert.NilError(t, err)
+
+	m := SnippetModel{db}
+
+	// Only the public snippet is found, so that the content of the
+	// protected one can't be read from the search results
+	snippets, total, err := m.Search("lightning", 1, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 1)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].Title, "Open")
+}
+
+func TestEnsureIndexesBurnedTTL(t *testing.T) {
+	// Skip the test if the "-short" flag is provided when running the test
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	err := EnsureIndexes(db)
+	assert.NilError(t, err)
+
+	cursor, err := db.Collection("burned_snippets").Indexes().List(context.TODO())
+	assert.NilError(t, err)
+
+	var indexes []bson.M
+	err = cursor.All(context.TODO(), &indexes)
+	assert.NilError(t, err)
+
+	// The tombstones of burned snippets are kept for 30 days
+	found := false
+	for _, index := range indexes {
+		if index["name"] == "burned_ttl_index" {
+			found = true
+			assert.Equal(t, index["expireAfterSeconds"], any(int32(30*24*60*60)))
+		}
+	}
+	assert.Equal(t, found, true)
+}
+
+// Ids which aren't valid ObjectIDs come from the URL, so they must be reported
+// like snippets which don't exist. They are rejected before the database is
+// used, so this test doesn't need one
+func TestSnippetModelInvalidID(t *testing.T) {
+	m := SnippetModel{}
+
+	_, err := m.Get("foo", "")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	_, err = m.Burn("foo", "")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	_, err = m.Fork("foo", "111111111111111111111111", time.Time{})
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	err = m.Delete("foo", "111111111111111111111111")
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+
+	_, err = (&RevisionModel{}).Get("foo", 1)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+// Purging an expired snippet also deletes the data which is of no use without
+// it, and leaves the data of the other snippets alone
+func TestSnippetModelPurgeExpiredCascade(t *testing.T) {
+	// Skip the test if the "-short" flag is provided when running the test
+	if testing.Short() {
+		t.Skip("models: skipping integration test")
+	}
+
+	db := newTestDB(t)
+
+	now := time.Now()
+	expiredID := primitive.NewObjectID()
+	keptID := primitive.NewObjectID()
+	userID := primitive.NewObjectID()
+
+	_, err := db.Collection("snippets").InsertMany(context.TODO(), []interface{}{
+		bson.D{{Key: "_id", Value: expiredID}, {Key: "title", Value: "Expired"}, {Key: "created", Value: now.Add(-2 * time.Hour)}, {Key: "expires", Value: now.Add(-time.Hour)}},
+		bson.D{{Key: "_id", Value: keptID}, {Key: "title", Value: "Expires later"}, {Key: "created", Value: now}, {Key: "expires", Value: now.Add(time.Hour)}},
+	})
+	assert.NilError(t, err)
+
+	for _, name := range []string{"snippet_revisions", "stars", "comments"} {
+		_, err = db.Collection(name).InsertMany(context.TODO(), []interface{}{
+			bson.D{{Key: "snippet_id", Value: expiredID}, {Key: "user_id", Value: userID}},
+			bson.D{{Key: "snippet_id", Value: keptID}, {Key: "user_id", Value: userID}},
+		})
+		assert.NilError(t, err)
+	}
+
+	_, err = db.Collection("collections").InsertOne(context.TODO(), bson.D{
+		{Key: "user_id", Value: userID},
+		{Key: "name", Value: "Haiku"},
+		{Key: "snippet_ids", Value: bson.A{expiredID, keptID}},
+	})
+	assert.NilError(t, err)
+
+	m := SnippetModel{db}
+
+	count, err := m.PurgeExpired(false)
+	assert.NilError(t, err)
+	assert.Equal(t, count, int64(1))
+
+	for _, name := range []string{"snippet_revisions", "stars", "comments"} {
+		remaining, err := db.Collection(name).CountDocuments(context.TODO(), bson.D{{Key: "snippet_id", Value: expiredID}})
+		assert.NilError(t, err)
+		assert.Equal(t, remaining, int64(0))
+
+		remaining, err = db.Collection(name).CountDocuments(context.TODO(), bson.D{{Key: "snippet_id", Value: keptID}})
+		assert.NilError(t, err)
+		assert.Equal(t, remaining, int64(1))
+	}
+
+	var collection struct {
+		SnippetIDs []primitive.ObjectID `bson:"snippet_ids"`
+	}
+	err = db.Collection("collections").FindOne(context.TODO(), bson.D{{Key: "name", Value: "Haiku"}}).Decode(&collection)
+	assert.NilError(t, err)
+	assert.Equal(t, len(collection.SnippetIDs), 1)
+	assert.Equal(t, collection.SnippetIDs[0], keptID)
+}
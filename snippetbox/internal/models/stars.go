@@ -0,0 +1,262 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type StarModelInterface interface {
+	Star(userID string, snippetID string) error
+	Unstar(userID string, snippetID string) error
+	IsStarred(userID string, snippetID string) (bool, error)
+	Starred(userID string, page int, pageSize int) ([]Snippet, int, error)
+	MostStarred(since time.Time, limit int) ([]Snippet, error)
+	DeleteAll(snippetID string) error
+}
+
+// Define a StarModel type which wraps a database connection pool. Every star
+// is a document of the "stars" collection holding the user, the snippet and
+// the time it was starred. The number of stars is also counted on the snippet
+// itself (Snippet.Stars), so that lists of snippets don't have to count them
+type StarModel struct {
+	DB *mongo.Database
+}
+
+// This will star the snippet for the user. Starring a snippet twice does
+// nothing: the unique index on the user and the snippet (see EnsureIndexes)
+// rejects the second star
+func (m *StarModel) Star(userID string, snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userObjID, snippetObjID, err := starIDs(userID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("stars").InsertOne(ctx, bson.D{
+		{Key: "user_id", Value: userObjID},
+		{Key: "snippet_id", Value: snippetObjID},
+		{Key: "created", Value: time.Now()},
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+		return err
+	}
+
+	return m.count(ctx, snippetObjID, 1)
+}
+
+// This will remove the star of the user from the snippet, if there is one
+func (m *StarModel) Unstar(userID string, snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userObjID, snippetObjID, err := starIDs(userID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.DB.Collection("stars").DeleteOne(ctx, bson.D{
+		{Key: "user_id", Value: userObjID},
+		{Key: "snippet_id", Value: snippetObjID},
+	})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return nil
+	}
+
+	return m.count(ctx, snippetObjID, -1)
+}
+
+// This will return true if the user has starred the snippet
+func (m *StarModel) IsStarred(userID string, snippetID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userObjID, snippetObjID, err := starIDs(userID, snippetID)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := m.DB.Collection("stars").CountDocuments(ctx, bson.D{
+		{Key: "user_id", Value: userObjID},
+		{Key: "snippet_id", Value: snippetObjID},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// This will return one page of the snippets starred by the user, the most
+// recently starred first, together with the total number of them. Snippets
+// which have expired or which the user can't see anymore are left out
+func (m *StarModel) Starred(userID string, page int, pageSize int) ([]Snippet, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	// Private snippets are visible only to their owner, and burn after
+	// reading snippets can't be starred
+	filter := bson.D{
+		{Key: "$and", Value: bson.A{
+			notExpiredFilter(),
+			bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "visibility", Value: bson.D{{Key: "$ne", Value: VisibilityPrivate}}}},
+				bson.D{{Key: "user_id", Value: userObjID}},
+			}}},
+		}},
+		{Key: "burn_after_reading", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "user_id", Value: userObjID}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}}}},
+	}
+	pipeline = append(pipeline, snippetStages(filter)...)
+
+	// Count all the snippets and return one page of them in a single query
+	pageStages := append(mongo.Pipeline{
+		{{Key: "$skip", Value: (page - 1) * pageSize}},
+		{{Key: "$limit", Value: pageSize}},
+	}, authorStages()...)
+
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.D{
+		{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+		{Key: "snippets", Value: pageStages},
+	}}})
+
+	cursor, err := m.DB.Collection("stars").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Total []struct {
+			Count int
+		}
+		Snippets []Snippet
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, 0, err
+	}
+
+	if len(results) == 0 || len(results[0].Total) == 0 {
+		return nil, 0, nil
+	}
+
+	return results[0].Snippets, results[0].Total[0].Count, nil
+}
+
+// This will return up to limit public, not expired snippets which got the
+// most stars since the given time, the most starred first
+func (m *StarModel) MostStarred(since time.Time, limit int) ([]Snippet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "created", Value: bson.D{{Key: "$gte", Value: since}}}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$snippet_id"},
+			{Key: "stars", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "starred", Value: bson.D{{Key: "$max", Value: "$created"}}},
+		}}},
+		// Of two snippets with as many stars, the most recently starred wins
+		{{Key: "$sort", Value: bson.D{{Key: "stars", Value: -1}, {Key: "starred", Value: -1}}}},
+		// The snippet id is the _id of the groups
+		{{Key: "$addFields", Value: bson.D{{Key: "snippet_id", Value: "$_id"}}}},
+	}
+	pipeline = append(pipeline, snippetStages(append(notExpiredFilter(), publicFilter...))...)
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	pipeline = append(pipeline, authorStages()...)
+
+	cursor, err := m.DB.Collection("stars").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var snippets []Snippet
+	if err := cursor.All(ctx, &snippets); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// This will remove all the stars of the snippet
+func (m *StarModel) DeleteAll(snippetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("stars").DeleteMany(ctx, bson.D{{Key: "snippet_id", Value: objID}})
+	return err
+}
+
+// Add n to the number of stars counted on the snippet
+func (m *StarModel) count(ctx context.Context, snippetID primitive.ObjectID, n int) error {
+	_, err := m.DB.Collection("snippets").UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: snippetID}},
+		bson.D{{Key: "$inc", Value: bson.D{{Key: "stars", Value: n}}}},
+	)
+	return err
+}
+
+// Return the aggregation stages which replace each star (or group of stars)
+// by the snippet in its snippet_id field, if that snippet matches filter.
+// Stars of snippets which don't match, or don't exist anymore, are dropped
+func snippetStages(filter bson.D) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "snippets"},
+			{Key: "let", Value: bson.D{{Key: "snippet_id", Value: "$snippet_id"}}},
+			{Key: "pipeline", Value: bson.A{
+				bson.D{{Key: "$match", Value: bson.D{{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$_id", "$$snippet_id"}}}}}}},
+				bson.D{{Key: "$match", Value: filter}},
+			}},
+			{Key: "as", Value: "snippet"},
+		}}},
+		{{Key: "$unwind", Value: "$snippet"}},
+		{{Key: "$replaceRoot", Value: bson.D{{Key: "newRoot", Value: "$snippet"}}}},
+	}
+}
+
+// Convert the ids of a user and a snippet to ObjectIDs
+func starIDs(userID string, snippetID string) (primitive.ObjectID, primitive.ObjectID, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+
+	snippetObjID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+
+	return userObjID, snippetObjID, nil
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The scopes of personal access tokens. Read-only tokens can only be used for
+// requests which don't change anything
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+// All the valid token scopes
+var TokenScopes = []string{ScopeRead, ScopeReadWrite}
+
+// Every token starts with this prefix, so that leaked tokens are easy to
+// recognize
+const tokenPrefix = "sbx_"
+
+type TokenModelInterface interface {
+	Insert(userID string, name string, scope string) (string, error)
+	ByOwner(userID string) ([]Token, error)
+	Authenticate(plaintext string) (Token, error)
+	Revoke(id string, userID string) error
+}
+
+// Define a Token type to hold a personal access token of a user. Only the
+// SHA-256 hash of the token is stored: the token itself is shown once, when
+// it is created
+type Token struct {
+	ID    string `bson:"_id,omitempty"`
+	Name  string
+	Scope string
+	Hash  []byte
+	// ID of the user the token authenticates as
+	UserID  string `bson:"user_id"`
+	Created time.Time
+	// The last time the token was used, zero if it never was
+	LastUsed time.Time `bson:"last_used,omitempty"`
+}
+
+// Define a TokenModel type which wraps a database connection pool
+type TokenModel struct {
+	DB *mongo.Database
+}
+
+// This will create a new token for the user and return it. The token is
+// random, so unlike passwords its hash doesn't need a salt, and a fast hash
+// lets it be looked up by its hash
+func (m *TokenModel) Insert(userID string, name string, scope string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", err
+	}
+
+	randomBytes := make([]byte, 32)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext := tokenPrefix + base64.RawURLEncoding.EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(plaintext))
+
+	_, err = m.DB.Collection("tokens").InsertOne(ctx, bson.D{
+		{Key: "name", Value: name},
+		{Key: "scope", Value: scope},
+		{Key: "hash", Value: hash[:]},
+		{Key: "user_id", Value: ownerID},
+		{Key: "created", Value: time.Now()},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// This will return all the tokens of the user, newest first
+func (m *TokenModel) ByOwner(userID string) ([]Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}})
+
+	cursor, err := m.DB.Collection("tokens").Find(ctx, bson.D{{Key: "user_id", Value: ownerID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []Token
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// This will return the token, and record that it has been used. Returns
+// ErrInvalidCredentials if there is no such token, or if it was revoked
+func (m *TokenModel) Authenticate(plaintext string) (Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	filter := bson.D{{Key: "hash", Value: hash[:]}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "last_used", Value: time.Now()}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token Token
+	err := m.DB.Collection("tokens").FindOneAndUpdate(ctx, filter, update, opts).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Token{}, ErrInvalidCredentials
+		}
+		return Token{}, err
+	}
+
+	return token, nil
+}
+
+// This will revoke the token, so that it can't be used anymore. Only the
+// user the token belongs to can revoke it
+func (m *TokenModel) Revoke(id string, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any token
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNoRecord
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	var token struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+
+	collection := m.DB.Collection("tokens")
+	filter := bson.D{{Key: "_id", Value: objID}}
+
+	err = collection.FindOneAndDelete(ctx, append(filter, bson.E{Key: "user_id", Value: ownerID})).Decode(&token)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	// Nothing was deleted: find out whether the token doesn't exist or
+	// belongs to another user
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrNotOwner
+	}
+
+	return ErrNoRecord
+}
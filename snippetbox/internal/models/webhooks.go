@@ -0,0 +1,404 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The events which webhooks are notified of
+const (
+	EventSnippetCreated = "snippet.created"
+	EventSnippetUpdated = "snippet.updated"
+	EventSnippetDeleted = "snippet.deleted"
+	EventSnippetExpired = "snippet.expired"
+)
+
+// The states of a webhook delivery. Pending deliveries are sent when their
+// NextAttempt is due, and retried until they are delivered or fail for good.
+// Cancelled deliveries turned out to be wrong before they were sent
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryCancelled = "cancelled"
+)
+
+type WebhookModelInterface interface {
+	Insert(userID string, url string) (string, error)
+	Get(id string) (Webhook, error)
+	ByOwner(userID string) ([]Webhook, error)
+	Delete(id string, userID string) error
+	Enqueue(userID string, event string, snippetID string, payload []byte, due time.Time) error
+	CancelPending(snippetID string, event string) error
+	Claim(lease time.Duration) (Delivery, error)
+	UpdateDelivery(delivery Delivery) error
+	Deliveries(userID string, page int, pageSize int) ([]Delivery, int, error)
+}
+
+// Define a Webhook type to hold a URL which is notified of the events of the
+// snippets of a user. The payloads are signed with the secret, so that the
+// receiver can check that they come from the application
+type Webhook struct {
+	ID      string `bson:"_id,omitempty"`
+	URL     string
+	Secret  string
+	UserID  string `bson:"user_id"`
+	Created time.Time
+}
+
+// Define a Delivery type to hold a payload queued for a webhook, and the
+// result of the last attempt to send it. The deliveries of a user make up
+// the delivery log
+type Delivery struct {
+	ID        string `bson:"_id,omitempty"`
+	WebhookID string `bson:"webhook_id"`
+	// The URL of the webhook when the delivery was queued
+	URL       string
+	UserID    string `bson:"user_id"`
+	Event     string
+	SnippetID string `bson:"snippet_id"`
+	// The JSON body which is sent
+	Payload []byte
+	// One of DeliveryPending, DeliveryDelivered, DeliveryFailed and
+	// DeliveryCancelled
+	Status      string
+	Attempts    int
+	NextAttempt time.Time `bson:"next_attempt"`
+	// The HTTP status code of the last attempt, 0 if there was no response
+	StatusCode int    `bson:"status_code"`
+	Error      string `bson:"error,omitempty"`
+	Created    time.Time
+	Updated    time.Time
+}
+
+// Define a WebhookModel type which wraps a database connection pool. The
+// "webhook_deliveries" collection is the delivery queue: it survives restarts,
+// and can be shared by several instances of the application (see Claim)
+type WebhookModel struct {
+	DB *mongo.Database
+}
+
+// This will store a new webhook of the user with a random secret, and
+// return its id
+func (m *WebhookModel) Insert(userID string, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", err
+	}
+
+	randomBytes := make([]byte, 24)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := m.DB.Collection("webhooks").InsertOne(ctx, bson.D{
+		{Key: "url", Value: url},
+		{Key: "secret", Value: hex.EncodeToString(randomBytes)},
+		{Key: "user_id", Value: ownerID},
+		{Key: "created", Value: time.Now()},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("models: unexpected id type %T", result.InsertedID)
+	}
+
+	return id.Hex(), nil
+}
+
+// This will return one webhook, or ErrNoRecord if there is no such webhook
+func (m *WebhookModel) Get(id string) (Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any webhook
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Webhook{}, ErrNoRecord
+	}
+
+	var webhook Webhook
+	err = m.DB.Collection("webhooks").FindOne(ctx, bson.D{{Key: "_id", Value: objID}}).Decode(&webhook)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Webhook{}, ErrNoRecord
+		}
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// This will return all the webhooks of the user, oldest first
+func (m *WebhookModel) ByOwner(userID string) ([]Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := m.DB.Collection("webhooks").Find(ctx, bson.D{{Key: "user_id", Value: ownerID}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var webhooks []Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// This will delete the webhook and the deliveries which are still pending
+// for it. The deliveries which were sent stay in the log. Only the owner
+// can delete a webhook
+func (m *WebhookModel) Delete(id string, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An invalid id can't match any webhook
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNoRecord
+	}
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	var webhook struct {
+		UserID primitive.ObjectID `bson:"user_id"`
+	}
+
+	opts := options.FindOne().SetProjection(bson.D{{Key: "user_id", Value: 1}})
+
+	err = m.DB.Collection("webhooks").FindOne(ctx, bson.D{{Key: "_id", Value: objID}}, opts).Decode(&webhook)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if webhook.UserID != ownerID {
+		return ErrNotOwner
+	}
+
+	_, err = m.DB.Collection("webhooks").DeleteOne(ctx, bson.D{{Key: "_id", Value: objID}})
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("webhook_deliveries").DeleteMany(ctx, bson.D{
+		{Key: "webhook_id", Value: objID},
+		{Key: "status", Value: DeliveryPending},
+	})
+	return err
+}
+
+// This will queue the payload of the event for every webhook of the user.
+// The deliveries are sent once due, so events can be scheduled in advance.
+// Webhooks which are added later don't get the events queued before
+func (m *WebhookModel) Enqueue(userID string, event string, snippetID string, payload []byte, due time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	snippetObjID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := m.DB.Collection("webhooks").Find(ctx, bson.D{{Key: "user_id", Value: ownerID}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var webhooks []struct {
+		ID  primitive.ObjectID `bson:"_id"`
+		URL string             `bson:"url"`
+	}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return err
+	}
+
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	docs := make([]interface{}, len(webhooks))
+	for i, webhook := range webhooks {
+		docs[i] = bson.D{
+			{Key: "webhook_id", Value: webhook.ID},
+			{Key: "url", Value: webhook.URL},
+			{Key: "user_id", Value: ownerID},
+			{Key: "event", Value: event},
+			{Key: "snippet_id", Value: snippetObjID},
+			{Key: "payload", Value: payload},
+			{Key: "status", Value: DeliveryPending},
+			{Key: "attempts", Value: 0},
+			{Key: "next_attempt", Value: due},
+			{Key: "status_code", Value: 0},
+			{Key: "created", Value: now},
+			{Key: "updated", Value: now},
+		}
+	}
+
+	_, err = m.DB.Collection("webhook_deliveries").InsertMany(ctx, docs)
+	return err
+}
+
+// This will remove the pending deliveries of the event for the snippet,
+// like the scheduled expiry of a snippet which was deleted
+func (m *WebhookModel) CancelPending(snippetID string, event string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snippetObjID, err := primitive.ObjectIDFromHex(snippetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.Collection("webhook_deliveries").DeleteMany(ctx, bson.D{
+		{Key: "snippet_id", Value: snippetObjID},
+		{Key: "event", Value: event},
+		{Key: "status", Value: DeliveryPending},
+	})
+	return err
+}
+
+// This will return the pending delivery which has been due the longest, and
+// postpone its next attempt by the lease. Another worker can't claim the
+// delivery until the lease is over, so if the worker which claimed it stops
+// before updating it (see UpdateDelivery), it is retried after the lease.
+// Returns ErrNoRecord if no delivery is due
+func (m *WebhookModel) Claim(lease time.Duration) (Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	filter := bson.D{
+		{Key: "status", Value: DeliveryPending},
+		{Key: "next_attempt", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "next_attempt", Value: now.Add(lease)}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery Delivery
+	err := m.DB.Collection("webhook_deliveries").FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Delivery{}, ErrNoRecord
+		}
+		return Delivery{}, err
+	}
+
+	return delivery, nil
+}
+
+// This will store the result of an attempt to send the delivery: its status,
+// number of attempts, next attempt, status code and error, and its payload,
+// which is refreshed when a delivery is rescheduled
+func (m *WebhookModel) UpdateDelivery(delivery Delivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(delivery.ID)
+	if err != nil {
+		return ErrNoRecord
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: delivery.Status},
+		{Key: "attempts", Value: delivery.Attempts},
+		{Key: "next_attempt", Value: delivery.NextAttempt},
+		{Key: "status_code", Value: delivery.StatusCode},
+		{Key: "error", Value: delivery.Error},
+		{Key: "payload", Value: delivery.Payload},
+		{Key: "updated", Value: time.Now()},
+	}}}
+
+	_, err = m.DB.Collection("webhook_deliveries").UpdateOne(ctx, bson.D{{Key: "_id", Value: objID}}, update)
+	return err
+}
+
+// This will return a page of the deliveries of the user, newest first,
+// together with the total number of deliveries. Pages are numbered from 1.
+// Deliveries scheduled for later (like the expiry of a snippet) are left
+// out until they are due
+func (m *WebhookModel) Deliveries(userID string, page int, pageSize int) ([]Delivery, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ownerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := bson.D{
+		{Key: "user_id", Value: ownerID},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "status", Value: bson.D{{Key: "$ne", Value: DeliveryPending}}}},
+			bson.D{{Key: "attempts", Value: bson.D{{Key: "$gt", Value: 0}}}},
+			bson.D{{Key: "next_attempt", Value: bson.D{{Key: "$lte", Value: time.Now()}}}},
+		}},
+	}
+
+	collection := m.DB.Collection("webhook_deliveries")
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize)).
+		SetProjection(bson.D{{Key: "payload", Value: 0}})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var deliveries []Delivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, int(total), nil
+}
@@ -0,0 +1,349 @@
+package sbclient
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `Usage: sbctl COMMAND [flags] [args]
+
+Commands:
+  login                 check and store the server address and API token
+  create -title TITLE   create a snippet from the standard input and print its URL
+  raw ID                print the content of a snippet
+  list                  list your snippets
+  delete ID...          delete snippets
+
+Every command accepts the flags -server, -token, -ca and -config, which
+override the stored settings. Run "sbctl COMMAND -h" for the other flags.
+`
+
+// Returned by the commands when they are used wrongly. The usage has already
+// been printed
+var errUsage = errors.New("usage")
+
+// Define a config type to hold the settings which "sbctl login" stores, so
+// that they don't have to be passed to every command
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+	CA     string `json:"ca,omitempty"`
+}
+
+// Return the default path of the configuration file
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "sbctl.json"
+	}
+	return filepath.Join(dir, "sbctl", "config.json")
+}
+
+// Define a command type to hold what every command needs: its flags, the
+// settings and the standard streams
+type command struct {
+	flags      *flag.FlagSet
+	configPath string
+	config     config
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+}
+
+// Create the flag set of the command with the flags shared by all the
+// commands. Their values are only known after parse()
+func newCommand(name string, stdin io.Reader, stdout io.Writer, stderr io.Writer) *command {
+	cmd := &command{
+		flags:  flag.NewFlagSet("sbctl "+name, flag.ContinueOnError),
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	cmd.flags.SetOutput(stderr)
+	cmd.flags.StringVar(&cmd.configPath, "config", defaultConfigPath(), "Path of the configuration file")
+	cmd.flags.StringVar(&cmd.config.Server, "server", "", "Address of the server, like https://localhost:4000")
+	cmd.flags.StringVar(&cmd.config.Token, "token", "", "Personal access token")
+	cmd.flags.StringVar(&cmd.config.CA, "ca", "", "PEM file with the certificate which signed the server's certificate, like ./tls/cert.pem")
+
+	return cmd
+}
+
+// Parse the arguments, and fill the settings which weren't passed as flags
+// from the configuration file, if there is one. The command must take nArgs
+// arguments after the flags, or at least one if nArgs is -1
+func (cmd *command) parse(args []string, nArgs int) error {
+	err := cmd.flags.Parse(args)
+	if err != nil {
+		return errUsage
+	}
+
+	n := cmd.flags.NArg()
+	if (nArgs >= 0 && n != nArgs) || (nArgs < 0 && n == 0) {
+		fmt.Fprintf(cmd.stderr, "%s: wrong number of arguments\n", cmd.flags.Name())
+		cmd.flags.Usage()
+		return errUsage
+	}
+
+	data, err := os.ReadFile(cmd.configPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var stored config
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return fmt.Errorf("invalid configuration file %s: %w", cmd.configPath, err)
+	}
+
+	if cmd.config.Server == "" {
+		cmd.config.Server = stored.Server
+	}
+	if cmd.config.Token == "" {
+		cmd.config.Token = stored.Token
+	}
+	if cmd.config.CA == "" {
+		cmd.config.CA = stored.CA
+	}
+
+	return nil
+}
+
+// Create the API client from the settings
+func (cmd *command) client() (*Client, error) {
+	if cmd.config.Server == "" {
+		return nil, errors.New(`no server, pass -server or run "sbctl login"`)
+	}
+
+	var rootCAs *x509.CertPool
+	if cmd.config.CA != "" {
+		var err error
+		rootCAs, err = LoadCA(cmd.config.CA)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return New(cmd.config.Server, cmd.config.Token, rootCAs), nil
+}
+
+// Run the sbctl command with the arguments (without the program name) and
+// return its exit status: 0 on success, 1 if the command failed and 2 if it
+// was used wrongly
+func Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	commands := map[string]func(*command, []string) error{
+		"login":  login,
+		"create": create,
+		"raw":    raw,
+		"list":   list,
+		"delete": remove,
+	}
+
+	run, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "sbctl: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	err := run(newCommand(args[0], stdin, stdout, stderr), args[1:])
+	if errors.Is(err, errUsage) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "sbctl: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// The login command checks that the server accepts the token, then stores
+// the settings in the configuration file. The file holds the token, so only
+// the user can read it
+func login(cmd *command, args []string) error {
+	err := cmd.parse(args, 0)
+	if err != nil {
+		return err
+	}
+
+	if cmd.config.Token == "" {
+		return errors.New("no token, pass -token")
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.List(1)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cmd.config, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(cmd.configPath), 0o700)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(cmd.configPath, append(data, '\n'), 0o600)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.stdout, "Logged in to %s\n", cmd.config.Server)
+	return nil
+}
+
+// The create command creates a snippet with the standard input as its
+// content, and prints the URL of its page
+func create(cmd *command, args []string) error {
+	var input SnippetInput
+	var tags string
+
+	cmd.flags.StringVar(&input.Title, "title", "", "Title of the snippet")
+	cmd.flags.StringVar(&input.Expires, "expires", "", "How long the snippet is kept: 10m, 1h, 1d, 7d, 365d, never or burn (default 365d)")
+	cmd.flags.StringVar(&input.Visibility, "visibility", "", "Who can see the snippet: public, unlisted or private (default public)")
+	cmd.flags.StringVar(&input.Language, "language", "", "Language of the content (detected when left out)")
+	cmd.flags.StringVar(&input.Filename, "filename", "", "File name of the content")
+	cmd.flags.StringVar(&tags, "tags", "", "Comma separated tags")
+
+	err := cmd.parse(args, 0)
+	if err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(cmd.stdin)
+	if err != nil {
+		return err
+	}
+	input.Content = string(content)
+
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			input.Tags = append(input.Tags, tag)
+		}
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	snippet, err := client.Create(input)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.stdout, client.SnippetURL(snippet.ID))
+	return nil
+}
+
+// The raw command prints the content of a snippet as it is. A burn after
+// reading snippet is deleted once it has been printed
+func raw(cmd *command, args []string) error {
+	var passphrase string
+	cmd.flags.StringVar(&passphrase, "passphrase", "", "Passphrase of a protected snippet")
+
+	err := cmd.parse(args, 1)
+	if err != nil {
+		return err
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	snippet, err := client.Get(cmd.flags.Arg(0), passphrase)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(cmd.stdout, snippet.Content)
+	return nil
+}
+
+// The list command prints a page of the snippets of the user
+func list(cmd *command, args []string) error {
+	var page int
+	cmd.flags.IntVar(&page, "page", 1, "Page to list")
+
+	err := cmd.parse(args, 0)
+	if err != nil {
+		return err
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	result, err := client.List(page)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(cmd.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tVISIBILITY\tEXPIRES")
+	for _, snippet := range result.Snippets {
+		expires := "never"
+		if snippet.Expires != nil {
+			expires = snippet.Expires.UTC().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", snippet.ID, snippet.Title, snippet.Visibility, expires)
+	}
+	tw.Flush()
+
+	// Tell the user when there are more pages
+	if result.PageSize > 0 && result.Page*result.PageSize < result.Total {
+		fmt.Fprintf(cmd.stdout, "\nPage %d of %d, see the next one with -page %d\n",
+			result.Page, (result.Total+result.PageSize-1)/result.PageSize, result.Page+1)
+	}
+
+	return nil
+}
+
+// The delete command deletes the snippets. It stops at the first one which
+// can't be deleted
+func remove(cmd *command, args []string) error {
+	err := cmd.parse(args, -1)
+	if err != nil {
+		return err
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range cmd.flags.Args() {
+		err := client.Delete(id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		fmt.Fprintf(cmd.stdout, "Deleted %s\n", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+// Package sbclient is a client for the JSON API of Snippetbox (/api/v1). It
+// also implements the commands of sbctl, the command-line client (see Run)
+package sbclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Define a File type to hold one of the additional files of a snippet
+type File struct {
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	Language string `json:"language,omitempty"`
+}
+
+// Define a Snippet type to hold a snippet returned by the API. Lists of
+// snippets leave out the content and the files. Expires is nil for snippets
+// which never expire
+type Snippet struct {
+	ID               string     `json:"id"`
+	Title            string     `json:"title"`
+	Content          string     `json:"content"`
+	Language         string     `json:"language"`
+	Filename         string     `json:"filename"`
+	Files            []File     `json:"files"`
+	Tags             []string   `json:"tags"`
+	Visibility       string     `json:"visibility"`
+	Protected        bool       `json:"protected"`
+	BurnAfterReading bool       `json:"burn_after_reading"`
+	UserID           string     `json:"user_id"`
+	Author           string     `json:"author"`
+	ForkedFrom       string     `json:"forked_from"`
+	Forks            int        `json:"forks"`
+	Stars            int        `json:"stars"`
+	Created          time.Time  `json:"created"`
+	Expires          *time.Time `json:"expires"`
+}
+
+// Define a SnippetInput type to hold a new snippet. Fields which are left
+// empty get the defaults of the server
+type SnippetInput struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Language   string   `json:"language,omitempty"`
+	Visibility string   `json:"visibility,omitempty"`
+	Passphrase string   `json:"passphrase,omitempty"`
+	Expires    string   `json:"expires,omitempty"`
+	Filename   string   `json:"filename,omitempty"`
+	Files      []File   `json:"files,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// Define a SnippetPage type to hold a page of the snippets of the user
+type SnippetPage struct {
+	Snippets []Snippet `json:"snippets"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+	Total    int       `json:"total"`
+}
+
+// Define an Error type to hold an error response of the API. Validation
+// errors have the errors of the fields too
+type Error struct {
+	StatusCode int
+	Message    string            `json:"error"`
+	Fields     map[string]string `json:"fields"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+
+	// Sort the fields, so that the message is always the same
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		msg += fmt.Sprintf("\n  %s: %s", key, e.Fields[key])
+	}
+
+	return msg
+}
+
+// Define a Client type to hold the address of a Snippetbox server and the
+// personal access token which the requests are authenticated with
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// Create a new Client for the server at baseURL (like
+// "https://localhost:4000"). If rootCAs isn't nil, the certificate of the
+// server is verified against it instead of the system roots, which allows
+// self-signed certificates
+func New(baseURL string, token string, rootCAs *x509.CertPool) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+	}
+}
+
+// Load the PEM encoded certificates in the file into a new pool, to be passed
+// to New()
+func LoadCA(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("sbclient: no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
+
+// Return the URL of the page of the snippet
+func (c *Client) SnippetURL(id string) string {
+	return c.baseURL + "/snippet/view/" + url.PathEscape(id)
+}
+
+// This will create a new snippet and return it
+func (c *Client) Create(input SnippetInput) (Snippet, error) {
+	var response struct {
+		Snippet Snippet `json:"snippet"`
+	}
+
+	err := c.do(http.MethodPost, "/api/v1/snippets", nil, input, &response)
+	return response.Snippet, err
+}
+
+// This will return the snippet with its content. The passphrase is only
+// needed for protected snippets of other users
+func (c *Client) Get(id string, passphrase string) (Snippet, error) {
+	var response struct {
+		Snippet Snippet `json:"snippet"`
+	}
+
+	header := http.Header{}
+	if passphrase != "" {
+		header.Set("X-Snippet-Passphrase", passphrase)
+	}
+
+	err := c.do(http.MethodGet, "/api/v1/snippets/"+url.PathEscape(id), header, nil, &response)
+	return response.Snippet, err
+}
+
+// This will return a page of the snippets of the user, newest first. Pages
+// are numbered from 1
+func (c *Client) List(page int) (SnippetPage, error) {
+	var response SnippetPage
+
+	query := url.Values{"page": {strconv.Itoa(page)}}
+
+	err := c.do(http.MethodGet, "/api/v1/account/snippets?"+query.Encode(), nil, nil, &response)
+	return response, err
+}
+
+// This will delete the snippet
+func (c *Client) Delete(id string) error {
+	return c.do(http.MethodDelete, "/api/v1/snippets/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Send a request to the API. The body is sent as JSON if it isn't nil, and
+// a successful response is decoded into dst if it isn't nil. Error responses
+// are returned as an *Error
+func (c *Client) do(method string, path string, header http.Header, body any, dst any) error {
+	var reqBody io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	rs, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode >= 400 {
+		apiErr := &Error{StatusCode: rs.StatusCode}
+		if err := json.NewDecoder(rs.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(rs.StatusCode)
+		}
+		return apiErr
+	}
+
+	if dst == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(rs.Body).Decode(dst)
+	if err != nil {
+		return errors.Join(errors.New("sbclient: invalid response"), err)
+	}
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package validator
 
 import (
+	"net/netip"
+	"net/url"
 	"regexp"
 	"slices"
 	"strings"
@@ -14,6 +16,13 @@ import (
 // variable is more performant than re-parsing the pattern each time we need it
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// Matches file names without any directory part, which are safe to use as
+// names of files in a zip archive and as HTML ids
+var FilenameRX = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]*$`)
+
+// Matches slugs: lowercase letters and digits, in words joined by single dashes
+var SlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
 // Define a new Validator struct which contains a map of validation error messages
 // for our form fields
 type Validator struct {
@@ -78,3 +87,76 @@ func MinChars(value string, n int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// Returns true if a list contains no more than n items
+func MaxItems[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
+// Returns true if no value of a list is repeated
+func Unique[T comparable](values []T) bool {
+	seen := make(map[T]bool, len(values))
+	for _, value := range values {
+		if seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
+// Returns true if a value is an absolute http or https URL
+func WebURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Returns true if the host of a URL may be on the public internet: it isn't
+// localhost nor an IP address which isn't public. Other host names can only
+// be checked once they are resolved, see PublicIP()
+func PublicHost(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(host)
+	return err != nil || PublicIP(addr)
+}
+
+// Address ranges which are global unicast in the net/netip sense, but aren't
+// reachable on the public internet or lead to private networks
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// Returns true if an IP address is a public unicast address. Loopback,
+// private, link-local (like the 169.254.169.254 metadata service of cloud
+// providers), multicast and the other special addresses are not
+func PublicIP(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
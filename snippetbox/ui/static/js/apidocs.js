@@ -0,0 +1,159 @@
+// Render the OpenAPI document of the JSON API into the docs page. Only the
+// parts of OpenAPI which the document uses are supported
+var docs = document.getElementById("api-docs");
+
+// Create an element with the class and the text
+function element(tag, className, text) {
+	var el = document.createElement(tag);
+	if (className) {
+		el.className = className;
+	}
+	if (text) {
+		el.textContent = text;
+	}
+	return el;
+}
+
+// Follow a local reference like "#/components/schemas/Snippet"
+function resolve(spec, value) {
+	while (value && value["$ref"]) {
+		var path = value["$ref"].replace(/^#\//, "").split("/");
+		value = spec;
+		for (var i = 0; i < path.length; i++) {
+			value = value[path[i]];
+		}
+	}
+	return value;
+}
+
+// Describe the type of a schema, like "array of Snippet"
+function typeName(spec, schema) {
+	if (schema["$ref"]) {
+		return schema["$ref"].split("/").pop();
+	}
+	if (schema.type == "array") {
+		return "array of " + typeName(spec, schema.items);
+	}
+	var name = schema.type || "object";
+	if (schema.format) {
+		name += " (" + schema.format + ")";
+	}
+	if (schema.enum) {
+		name += ": " + schema.enum.join(", ");
+	}
+	return name;
+}
+
+// Render a table with a row for every field of the object schema
+function fieldTable(spec, schema) {
+	schema = resolve(spec, schema);
+	var required = schema.required || [];
+	var table = element("table");
+	var header = element("tr");
+	header.appendChild(element("th", "", "Field"));
+	header.appendChild(element("th", "", "Type"));
+	header.appendChild(element("th", "", "Description"));
+	table.appendChild(header);
+
+	var properties = schema.properties || {};
+	for (var name in properties) {
+		var property = properties[name];
+		var row = element("tr");
+		row.appendChild(element("td", "", name + (required.indexOf(name) >= 0 ? " *" : "")));
+		row.appendChild(element("td", "", typeName(spec, property)));
+		row.appendChild(element("td", "", property.description || ""));
+		table.appendChild(row);
+	}
+	return table;
+}
+
+// Render one operation of a path
+function operation(spec, path, method, op, pathParameters) {
+	var section = element("section", "operation");
+	var title = element("h3");
+	title.appendChild(element("span", "method " + method, method.toUpperCase()));
+	title.appendChild(element("code", "", spec.servers[0].url + path));
+	section.appendChild(title);
+	section.appendChild(element("p", "summary", op.summary));
+	if (op.description) {
+		section.appendChild(element("p", "", op.description));
+	}
+
+	var security = op.security || spec.security;
+	var anonymous = security.some(function (s) { return Object.keys(s).length == 0; });
+	section.appendChild(element("p", "auth", anonymous ? "Authentication is optional" : "Authentication is required"));
+
+	var parameters = (pathParameters || []).concat(op.parameters || []);
+	if (parameters.length > 0) {
+		section.appendChild(element("h4", "", "Parameters"));
+		var table = element("table");
+		for (var i = 0; i < parameters.length; i++) {
+			var parameter = resolve(spec, parameters[i]);
+			var row = element("tr");
+			row.appendChild(element("td", "", parameter.name + (parameter.required ? " *" : "")));
+			row.appendChild(element("td", "", parameter.in));
+			row.appendChild(element("td", "", typeName(spec, parameter.schema)));
+			row.appendChild(element("td", "", parameter.description || ""));
+			table.appendChild(row);
+		}
+		section.appendChild(table);
+	}
+
+	if (op.requestBody) {
+		section.appendChild(element("h4", "", "Request body"));
+		section.appendChild(fieldTable(spec, op.requestBody.content["application/json"].schema));
+	}
+
+	section.appendChild(element("h4", "", "Responses"));
+	var list = element("ul", "responses");
+	for (var status in op.responses) {
+		var response = resolve(spec, op.responses[status]);
+		var item = element("li");
+		item.appendChild(element("code", "", status));
+		var text = " " + response.description;
+		if (response.content) {
+			text += " (" + typeName(spec, response.content["application/json"].schema) + ")";
+		}
+		item.appendChild(document.createTextNode(text));
+		list.appendChild(item);
+	}
+	section.appendChild(list);
+
+	return section;
+}
+
+function render(spec) {
+	docs.textContent = "";
+	docs.appendChild(element("h2", "", spec.info.title + " " + spec.info.version));
+	docs.appendChild(element("p", "", spec.info.description));
+
+	var methods = ["get", "post", "put", "patch", "delete"];
+	for (var path in spec.paths) {
+		var item = spec.paths[path];
+		for (var i = 0; i < methods.length; i++) {
+			if (item[methods[i]]) {
+				docs.appendChild(operation(spec, path, methods[i], item[methods[i]], item.parameters));
+			}
+		}
+	}
+
+	docs.appendChild(element("h2", "", "Schemas"));
+	var schemas = spec.components.schemas;
+	for (var name in schemas) {
+		docs.appendChild(element("h3", "", name));
+		docs.appendChild(fieldTable(spec, schemas[name]));
+	}
+}
+
+fetch("/api/openapi.json")
+	.then(function (response) {
+		if (!response.ok) {
+			throw new Error(response.statusText);
+		}
+		return response.json();
+	})
+	.then(render)
+	.catch(function (err) {
+		docs.textContent = "";
+		docs.appendChild(element("p", "error", "The API documentation could not be loaded: " + err.message));
+	});